@@ -5,7 +5,9 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"github.com/satyamkale27/Go-social.git/internal/blob"
 	"github.com/satyamkale27/Go-social.git/internal/mailer"
+	"github.com/satyamkale27/Go-social.git/internal/oidc"
 	store2 "github.com/satyamkale27/Go-social.git/internal/store"
 	"go.uber.org/zap"
 	"net/http"
@@ -18,6 +20,8 @@ type application struct {
 	logger        *zap.SugaredLogger
 	mailer        mailer.Client
 	authenticator auth.Authenticator // custom made package by me not in built
+	oidc          *oidc.Provider     // nil when OpenID Connect login is not configured
+	blobs         blob.BlobStore     // attachment files
 }
 
 type config struct {
@@ -28,16 +32,51 @@ type config struct {
 	mail        mailConfig
 	frontendUrl string
 	auth        authConfig
+	cleanup     cleanupConfig
+	scheduler   schedulerConfig
+	tags        tagsConfig
+	posts       postsConfig
+	media       mediaConfig
 }
 
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic   basicConfig
+	token   tokenConfig
+	lockout lockoutConfig
+	mfa     mfaConfig
+	oidc    oidcConfig
+}
+
+type oidcConfig struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	stateExpiry  time.Duration
+}
+
+type mfaConfig struct {
+	issuer        string        // shown in authenticator apps
+	pendingExpiry time.Duration // lifetime of the token between password and second factor
+	enforceLevel  int           // users whose role level is at least this must enable 2FA, 0 disables
 }
 type tokenConfig struct {
-	secret string
-	expiry time.Duration
-	iss    string
+	secret        string
+	expiry        time.Duration
+	refreshExpiry time.Duration
+	iss           string
+	signing       string // "hs256" or "asymmetric"
+	keysDir       string
+	activeKID     string
+	retiredKIDs   []string
+}
+
+type lockoutConfig struct {
+	maxAccountFailures int
+	maxIPFailures      int
+	window             time.Duration
+	duration           time.Duration
 }
 
 type basicConfig struct {
@@ -49,6 +88,50 @@ type mailConfig struct {
 	sendGrid  sendgridConfig
 	fromEmail string
 	exp       time.Duration
+	resetExp  time.Duration
+	resend    resendConfig
+}
+
+type resendConfig struct {
+	maxPerEmail int // activation or password reset mails one email can request per window
+	window      time.Duration
+}
+
+type cleanupConfig struct {
+	interval         time.Duration
+	unactivatedGrace time.Duration // never activated accounts older than this are deleted
+	trashRetention   time.Duration // deleted posts and comments can be restored for this long
+}
+
+type postsConfig struct {
+	requireIfMatch bool // reject edits and deletes of posts without an If-Match header
+	maxPinned      int  // posts a user can pin to their profile
+}
+
+type mediaConfig struct {
+	storage       string // "local" or "s3"
+	localDir      string
+	s3            s3Config
+	maxUploadSize int64 // bytes
+	maxPerPost    int
+	urlSecret     string // signs the attachment URLs
+	urlExpiry     time.Duration
+}
+
+type s3Config struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+}
+
+type schedulerConfig struct {
+	interval time.Duration // how often scheduled posts that are due get published
+}
+
+type tagsConfig struct {
+	refreshInterval time.Duration // how often the tag counts are recomputed
 }
 
 type sendgridConfig struct {
@@ -73,40 +156,119 @@ func (app *application) mount() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 		// cors allowed
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	r.Route("/v1", func(r chi.Router) {
 		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthcheckHandler)
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
-			r.Get("/allUserPosts", app.getAllPostsHandler)
+			r.With(app.requireScope(scopePostsWrite)).Post("/", app.createPostHandler)
+			r.With(app.requireScope(scopePostsRead)).Get("/allUserPosts", app.getAllPostsHandler)
 			r.Route("/{postId}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
-				r.Get("/", app.getPostHandler)
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.With(app.requireScope(scopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+				r.With(app.requireScope(scopePostsWrite)).Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.With(app.requireScope(scopePostsRead)).Get("/revisions", app.getRevisionsHandler)
+				r.With(app.requireScope(scopePostsRead)).Get("/revisions/diff", app.diffRevisionsHandler)
+				r.With(app.requireScope(scopePostsWrite), app.requireRole("moderator")).Post("/revisions/{version}/revert", app.revertPostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Put("/reactions/{kind}", app.addReactionHandler)
+				r.With(app.requireScope(scopePostsWrite)).Delete("/reactions/{kind}", app.removeReactionHandler)
+				r.With(app.requireScope(scopePostsWrite)).Put("/repost", app.repostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Delete("/repost", app.undoRepostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Post("/poll/votes", app.votePollHandler)
+				r.With(app.requireScope(scopePostsWrite)).Put("/pin", app.pinPostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Delete("/pin", app.unpinPostHandler)
+				r.With(app.requireScope(scopePostsWrite), app.requireRole("moderator")).Put("/announcement", app.announcePostHandler)
+				r.With(app.requireScope(scopePostsWrite), app.requireRole("moderator")).Delete("/announcement", app.removeAnnouncementHandler)
+				r.With(app.requireScope(scopePostsWrite)).Post("/attachments", app.uploadAttachmentHandler)
+				r.With(app.requireScope(scopePostsWrite)).Delete("/attachments/{attachmentId}", app.checkPostOwnership("admin", app.deleteAttachmentHandler))
+
+				r.Route("/comments", func(r chi.Router) {
+					r.With(app.requireScope(scopePostsRead)).Get("/", app.getCommentsHandler)
+					r.With(app.requireScope(scopePostsWrite)).Post("/", app.createCommentHandler)
+					r.Route("/{commentId}", func(r chi.Router) {
+						r.Use(app.commentsContextMiddleware)
+						r.With(app.requireScope(scopePostsRead)).Get("/replies", app.getRepliesHandler)
+						r.With(app.requireScope(scopePostsWrite)).Patch("/", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+						r.With(app.requireScope(scopePostsWrite)).Delete("/", app.checkCommentOwnership("admin", app.deleteCommentHandler))
+					})
+				})
 			})
 		})
+		r.With(app.AuthTokenMiddleware, app.requireScope(scopePostsRead)).Get("/tags", app.getTagsHandler)
+		// public route, access is granted by the signature in the URL
+		r.Get("/media/{attachmentId}", app.serveMediaHandler)
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Post("/activate/resend", app.resendActivationHandler)
 			r.Route("/{userId}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(scopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.requireScope(scopeUsersRead)).Get("/profile", app.getUserProfileHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/follow", app.followUserHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireSession, app.requireRole("admin")).Post("/logout", app.logoutUserHandler)
+			})
+
+			r.Route("/me", func(r chi.Router) {
+				r.Route("/mfa/totp", func(r chi.Router) {
+					r.Use(app.allowWithoutMFA)
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.requireSession)
+					r.Post("/", app.enrollTOTPHandler)
+					r.Post("/confirm", app.confirmTOTPHandler)
+					r.Delete("/", app.disableTOTPHandler)
+				})
+				r.Route("/tokens", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.requireSession)
+					r.Get("/", app.listPersonalAccessTokensHandler)
+					r.Post("/", app.createPersonalAccessTokenHandler)
+					r.Delete("/{tokenId}", app.revokePersonalAccessTokenHandler)
+				})
+				r.Route("/collections", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.With(app.requireScope(scopeUsersRead)).Get("/", app.listCollectionsHandler)
+					r.With(app.requireScope(scopeUsersWrite)).Post("/", app.createCollectionHandler)
+					r.Route("/{collectionId}", func(r chi.Router) {
+						r.Use(app.collectionsContextMiddleware)
+						r.With(app.requireScope(scopeUsersRead)).Get("/", app.getCollectionHandler)
+						r.With(app.requireScope(scopeUsersWrite)).Patch("/", app.renameCollectionHandler)
+						r.With(app.requireScope(scopeUsersWrite)).Delete("/", app.deleteCollectionHandler)
+						r.With(app.requireScope(scopeUsersRead)).Get("/posts", app.getCollectionPostsHandler)
+						r.With(app.requireScope(scopeUsersWrite)).Put("/posts/{postId}", app.savePostHandler)
+						r.With(app.requireScope(scopeUsersWrite)).Delete("/posts/{postId}", app.unsavePostHandler)
+					})
+				})
+				r.With(app.AuthTokenMiddleware, app.requireScope(scopePostsRead)).Get("/mentions", app.getMentionsHandler)
+				r.Route("/trash", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.With(app.requireScope(scopePostsRead)).Get("/posts", app.getPostTrashHandler)
+					r.With(app.requireScope(scopePostsWrite)).Post("/posts/{postId}/restore", app.restorePostHandler)
+					r.With(app.requireScope(scopePostsRead)).Get("/comments", app.getCommentTrashHandler)
+					r.With(app.requireScope(scopePostsWrite)).Post("/comments/{commentId}/restore", app.restoreCommentHandler)
+				})
+				r.Route("/sessions", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.requireSession)
+					r.Get("/", app.listSessionsHandler)
+					r.Delete("/{sessionId}", app.revokeSessionHandler)
+				})
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.With(app.requireScope(scopeFeedRead)).Get("/feed", app.getUserFeedHandler)
 
 			})
 
@@ -116,6 +278,21 @@ func (app *application) mount() http.Handler {
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/token/mfa", app.verifyMFAHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+			if app.oidc != nil {
+				r.Get("/oidc/login", app.oidcLoginHandler)
+				r.Get("/oidc/callback", app.oidcCallbackHandler)
+			}
+			r.Group(func(r chi.Router) {
+				r.Use(app.allowWithoutMFA)
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireSession)
+				r.Post("/logout", app.logoutHandler)
+				r.Post("/logout/all", app.logoutAllHandler)
+			})
 		})
 
 	})
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/blob"
+	"github.com/satyamkale27/Go-social.git/internal/media"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// extensions of the stored files by content type, the uploaded file name is only kept for display
+var attachmentExtensions = map[string]string{
+	"image/jpeg":                ".jpg",
+	"image/png":                 ".png",
+	"image/gif":                 ".gif",
+	"application/pdf":           ".pdf",
+	"text/plain; charset=utf-8": ".txt",
+}
+
+// uploadAttachmentHandler adds the file of a multipart/form-data upload, in the "file" field, to
+// the post. The type is sniffed from the content and images are re-encoded without their metadata.
+func (app *application) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if post.UserID != user.Id {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	data, filename, err := app.readUpload(w, r)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr), errors.Is(err, errUploadTooLarge):
+			app.payloadTooLargeResponse(w, r, fmt.Errorf("files may be at most %d bytes", app.config.media.maxUploadSize))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	file, err := media.Process(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrUnsupportedType):
+			app.unsupportedMediaTypeResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	attachment := &store.Attachment{
+		PostID:      post.Id,
+		UserID:      user.Id,
+		Key:         fmt.Sprintf("posts/%d/%s%s", post.Id, uuid.New().String(), attachmentExtensions[file.ContentType]),
+		Filename:    filename,
+		ContentType: file.ContentType,
+		Size:        int64(len(file.Data)),
+	}
+	if file.Width > 0 {
+		attachment.Width, attachment.Height = &file.Width, &file.Height
+	}
+
+	ctx := r.Context()
+	if err := app.blobs.Put(ctx, attachment.Key, file.Data, file.ContentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Attachments.Create(ctx, attachment, app.config.media.maxPerPost); err != nil {
+		app.deleteBlob(attachment.Key)
+		switch {
+		case errors.Is(err, store.ErrTooManyAttachments):
+			app.badRequestResponse(w, r, fmt.Errorf("a post can have at most %d attachments", app.config.media.maxPerPost))
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.signAttachmentURL(attachment)
+	if err := app.jsonResponse(w, http.StatusCreated, attachment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var errUploadTooLarge = errors.New("upload too large")
+
+// readUpload reads the "file" part of a multipart upload, stopping as soon as it is over the size limit.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	limit := app.config.media.maxUploadSize
+	// room for the multipart boundaries and headers
+	r.Body = http.MaxBytesReader(w, r.Body, limit+64<<10)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", fmt.Errorf("the upload has no file field")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, limit+1))
+		part.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		if int64(len(data)) > limit {
+			return nil, "", errUploadTooLarge
+		}
+		if len(data) == 0 {
+			return nil, "", fmt.Errorf("the file is empty")
+		}
+		return data, cleanFilename(part.FileName()), nil
+	}
+}
+
+// cleanFilename keeps the base name of an uploaded file without control characters or quotes,
+// it ends up in a Content-Disposition header.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
+
+// deleteAttachmentHandler removes an attachment from the post, and its file from storage.
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "attachmentId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	attachment, err := app.store.Attachments.Delete(r.Context(), post.Id, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.deleteBlob(attachment.Key)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveMediaHandler streams an attachment. It is not behind authentication, the signature of the
+// URL handed out with the post proves the requester was allowed to see it, until the URL expires.
+func (app *application) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "attachmentId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	signature := r.URL.Query().Get("signature")
+	if !hmac.Equal([]byte(signature), []byte(app.mediaSignature(id, expires))) || time.Now().Unix() > expires {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	attachment, err := app.store.Attachments.GetById(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	content, err := app.blobs.Get(ctx, attachment.Key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", attachment.ContentType)
+	h.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'")
+	h.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", expires-time.Now().Unix()))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		app.logger.Warnw("error streaming attachment", "attachment", id, "error", err)
+	}
+}
+
+// mediaSignature signs an attachment id with the time the URL stops working.
+func (app *application) mediaSignature(id, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.media.urlSecret))
+	fmt.Fprintf(mac, "%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signAttachmentURL sets the URL the attachment can be downloaded from for at least two thirds of
+// MEDIA_URL_EXPIRY. The expiry is rounded so the URL, and the ETag of the post, stay the same for a while.
+func (app *application) signAttachmentURL(a *store.Attachment) {
+	expiry := app.config.media.urlExpiry
+	expiresAt := time.Now().Truncate(expiry / 3).Add(expiry)
+	expires := expiresAt.Unix()
+
+	a.URL = fmt.Sprintf("%s/v1/media/%d?expires=%d&signature=%s", app.config.apiURL, a.ID, expires, app.mediaSignature(a.ID, expires))
+	a.URLExpiresAt = &expiresAt
+}
+
+// loadAttachments sets the attachments, with signed URLs, on posts that were loaded without them.
+func (app *application) loadAttachments(ctx context.Context, posts ...*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.Id
+	}
+
+	attachments, err := app.store.Attachments.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Attachments = attachments[p.Id]
+		if p.Attachments == nil {
+			p.Attachments = []store.Attachment{}
+		}
+		for i := range p.Attachments {
+			app.signAttachmentURL(&p.Attachments[i])
+		}
+	}
+	return nil
+}
+
+// deleteBlob removes a file in the background of a request, a failure leaves an orphaned file
+// behind but must not fail the request.
+func (app *application) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := app.blobs.Delete(ctx, key); err != nil {
+		app.logger.Errorw("error deleting blob", "key", key, "error", err)
+	}
+}
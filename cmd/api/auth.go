@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
 	"github.com/satyamkale27/Go-social.git/internal/mailer"
 	"github.com/satyamkale27/Go-social.git/internal/store"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -118,13 +125,31 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ctx := r.Context()
+	email := strings.ToLower(payload.Email)
+	ip := clientIP(r)
+
+	// refuse early while the account or the ip is locked out, without touching the password
+	lockedUntil, err := app.loginLockedUntil(ctx, email, ip)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+		app.rateLimitExceededResponse(w, r, strconv.Itoa(retryAfter))
+		return
+	}
+
 	// fetch the user (check if the user exists) from payload
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
 		switch err {
 		case store.ErrNotFound:
-			app.unauthorizedErrorResponse(w, r, err)
+			// compare anyway so an unknown email takes as long as a wrong password
+			_ = dummyUser.Password.Compare(payload.Password)
+			app.loginFailed(w, r, email, ip, err)
 
 		default:
 			app.internalServerError(w, r, err)
@@ -132,24 +157,315 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// generate the token -> add claims
+	if err := user.Password.Compare(payload.Password); err != nil {
+		app.loginFailed(w, r, email, ip, err)
+		return
+	}
+
+	// with 2FA enabled the password alone only earns a token for the second step. The failure count
+	// is kept until the code is verified, re-sending the password must not reset it between guesses.
+	if user.TOTPEnabled {
+		mfaToken, err := app.issueMFAToken(ctx, user)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
 
-	claims := jwt.MapClaims{
-		"sub": user.Id,
-		"exp": time.Now().Add(app.config.auth.token.expiry).Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": app.config.auth.token.iss,
-		"aud": app.config.auth.token.iss,
+		challenge := MFAChallenge{MFARequired: true, MFAToken: mfaToken}
+		if err := app.jsonResponse(w, http.StatusOK, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.LoginAttempts.Reset(ctx, store.LoginScopeAccount, email); err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
 
-	token, err := app.authenticator.GenerateToken(claims)
+	// generate the access and refresh tokens, every login starts a new session
+
+	tokens, err := app.startSession(r, user.Id)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
 	// send it to the client
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	current, err := app.store.RefreshTokens.Consume(ctx, auth.HashToken(payload.RefreshToken))
+	if err != nil {
+		switch err {
+		case store.ErrRefreshTokenReused:
+			app.logger.Warnw("refresh token reused, token family revoked", "ip", clientIP(r))
+			app.unauthorizedErrorResponse(w, r, err)
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the user may have been deactivated since the token was issued
+	user, err := app.store.Users.GetById(ctx, current.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.issueTokens(ctx, user.Id, current.FamilyID)
+	if err != nil {
 		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Sessions.Extend(ctx, current.FamilyID, tokens.RefreshTokenExpiresAt); err != nil {
+		switch {
+		case errors.Is(err, store.ErrSessionRevoked):
+			// the session was ended while this refresh was under way, the new tokens must not outlive it
+			if err := app.store.RefreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		case errors.Is(err, store.ErrNotFound):
+			// the refresh token predates sessions, record one for it from here on
+			err = app.createSession(r, user.Id, current.FamilyID, tokens.RefreshTokenExpiresAt)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		default:
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// startSession records a new login from the requesting device and issues its first token pair.
+func (app *application) startSession(r *http.Request, userID int64) (*auth.TokenPair, error) {
+	sessionID := uuid.New().String()
+
+	tokens, err := app.issueTokens(r.Context(), userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.createSession(r, userID, sessionID, tokens.RefreshTokenExpiresAt); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (app *application) createSession(r *http.Request, userID int64, sessionID string, expiry time.Time) error {
+	userAgent := r.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	session := &store.Session{
+		Id:        sessionID,
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        clientIP(r),
+		Expiry:    expiry,
+	}
+	return app.store.Sessions.Create(r.Context(), session)
+}
+
+// issueTokens creates a token pair for the session and persists the refresh token in the session's family.
+func (app *application) issueTokens(ctx context.Context, userID int64, sessionID string) (*auth.TokenPair, error) {
+	generation, err := app.store.Revocations.Generation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := app.authenticator.IssueTokens(userID, sessionID, generation)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := &store.RefreshToken{
+		Token:    tokens.RefreshTokenHash,
+		UserID:   userID,
+		FamilyID: sessionID,
+		Expiry:   tokens.RefreshTokenExpiresAt,
+	}
+	if err := app.store.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"omitempty,max=255"`
+}
+
+// logoutHandler revokes the access token used for the request and ends its session, which revokes
+// the session's refresh tokens. A refresh_token sent along has its own login revoked as well.
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload LogoutPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	claims := getClaimsFromContext(r)
+	ctx := r.Context()
+
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Revocations.Revoke(ctx, jti, user.Id, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		if err := app.store.RefreshTokens.RevokeFamilyOf(ctx, auth.HashToken(payload.RefreshToken), user.Id); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	if err := app.store.Sessions.Revoke(ctx, user.Id, sessionID); err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.revokeAllSessions(r.Context(), user.Id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutUserHandler lets an admin log a (possibly compromised) account out everywhere.
+func (app *application) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.revokeAllSessions(r.Context(), userId); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("user logged out everywhere by admin", "user_id", userId, "admin_id", getUserFromContext(r).Id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllSessions invalidates every access, refresh and personal access token the user holds.
+func (app *application) revokeAllSessions(ctx context.Context, userId int64) error {
+	if err := app.store.Revocations.RevokeAllForUser(ctx, userId); err != nil {
+		return err
+	}
+	if err := app.store.Sessions.RevokeAllForUser(ctx, userId); err != nil {
+		return err
+	}
+	if err := app.store.RefreshTokens.RevokeAllForUser(ctx, userId); err != nil {
+		return err
+	}
+	return app.store.PersonalAccessTokens.RevokeAllForUser(ctx, userId)
+}
+
+// dummyUser holds a real bcrypt hash that is compared against when the email is unknown.
+var dummyUser = func() *store.User {
+	user := &store.User{}
+	if err := user.Password.Set(uuid.New().String()); err != nil {
+		panic(err)
+	}
+	return user
+}()
+
+func (app *application) loginLockedUntil(ctx context.Context, email, ip string) (time.Time, error) {
+	accountLock, err := app.store.LoginAttempts.LockedUntil(ctx, store.LoginScopeAccount, email)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ipLock, err := app.store.LoginAttempts.LockedUntil(ctx, store.LoginScopeIP, ip)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ipLock.After(accountLock) {
+		return ipLock, nil
+	}
+	return accountLock, nil
+}
+
+// loginFailed records the failure against both the account and the ip and answers with the same
+// response whether the email exists or the password is wrong.
+func (app *application) loginFailed(w http.ResponseWriter, r *http.Request, email, ip string, err error) {
+	ctx := r.Context()
+	lockout := app.config.auth.lockout
+
+	if err := app.store.LoginAttempts.RegisterFailure(ctx, store.LoginScopeAccount, email, lockout.maxAccountFailures, lockout.window, lockout.duration); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.LoginAttempts.RegisterFailure(ctx, store.LoginScopeIP, ip, lockout.maxIPFailures, lockout.window, lockout.duration); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.unauthorizedErrorResponse(w, r, err)
+}
+
+func clientIP(r *http.Request) string {
+	// middleware.RealIP already replaced RemoteAddr with the forwarded address when there is one
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strconv"
+)
+
+type collectionKey string
+
+const collectionCtx collectionKey = "collection"
+
+type CollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	collection := &store.Collection{
+		UserID: user.Id,
+		Name:   payload.Name,
+	}
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponce(w, r, fmt.Errorf("a collection named %q already exists", payload.Name))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	collections, err := app.store.Bookmarks.GetCollections(r.Context(), user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getCollectionFromContext(r)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) renameCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := getCollectionFromContext(r)
+	collection.Name = payload.Name
+
+	if err := app.store.Bookmarks.RenameCollection(r.Context(), collection); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponce(w, r, fmt.Errorf("a collection named %q already exists", payload.Name))
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collection); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getCollectionFromContext(r)
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), collection.UserID, collection.Id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getCollectionPostsHandler lists the saved posts, newest saves first, with the feed's tags and search filters.
+func (app *application) getCollectionPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := getCollectionFromContext(r)
+
+	posts, err := app.store.Bookmarks.GetPosts(r.Context(), collection.Id, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	list := make([]*store.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i].Post
+	}
+	if err := app.loadPostDetails(r.Context(), getUserFromContext(r), list...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) savePostHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := getCollectionFromContext(r)
+
+	if err := app.store.Bookmarks.AddPost(r.Context(), collection.Id, postId); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unsavePostHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := getCollectionFromContext(r)
+
+	if err := app.store.Bookmarks.RemovePost(r.Context(), collection.Id, postId); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// collectionsContextMiddleware loads a collection of the authenticated user, other users' collections are not found.
+func (app *application) collectionsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "collectionId"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		user := getUserFromContext(r)
+		ctx := r.Context()
+
+		collection, err := app.store.Bookmarks.GetCollection(ctx, user.Id, id)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, collectionCtx, collection)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCollectionFromContext(r *http.Request) *store.Collection {
+	collection, _ := r.Context().Value(collectionCtx).(*store.Collection)
+	return collection
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strconv"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+// maxCommentDepth is how deep replies can nest, top level comments have depth 0.
+const maxCommentDepth = 5
+
+type CreateCommentPayload struct {
+	Content  string `json:"content" validate:"required,max=1000"`
+	ParentID *int64 `json:"parent_id" validate:"omitempty,min=1"` // set to reply to a comment
+}
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+	ctx := r.Context()
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetById(ctx, *payload.ParentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.badRequestResponse(w, r, fmt.Errorf("parent comment not found"))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if parent.PostID != post.Id {
+			app.badRequestResponse(w, r, fmt.Errorf("parent comment not found"))
+			return
+		}
+		if parent.Depth+1 > maxCommentDepth {
+			app.badRequestResponse(w, r, fmt.Errorf("replies cannot be nested deeper than %d levels", maxCommentDepth))
+			return
+		}
+	}
+
+	comment := &store.Comment{
+		PostID:   post.Id,
+		UserID:   user.Id,
+		ParentID: payload.ParentID,
+		Content:  payload.Content,
+		User:     store.User{Id: user.Id, Username: user.Username},
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			// the parent was deleted in the meantime
+			app.badRequestResponse(w, r, fmt.Errorf("parent comment not found"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getCommentsHandler lists the top level comments of the post, each with a preview of its replies.
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listComments(w, r, nil)
+}
+
+// getRepliesHandler pages through the replies of a comment, it is how clients load more replies.
+func (app *application) getRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	app.listComments(w, r, &comment.ID)
+}
+
+func (app *application) listComments(w http.ResponseWriter, r *http.Request, parentID *int64) {
+	q := store.CommentQuery{
+		PaginatedQuery: store.PaginatedQuery{
+			Limit:  20,
+			Offset: 0,
+			Sort:   "asc",
+		},
+		ParentID: parentID,
+		Replies:  3,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view != "" && view != "tree" && view != "flat" {
+		app.badRequestResponse(w, r, fmt.Errorf("view must be tree or flat"))
+		return
+	}
+
+	post := getPostFromContext(r)
+
+	comments, err := app.store.Comments.GetPageByPostID(r.Context(), post.Id, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the flat list is in thread order, depth and path tell clients how to indent it
+	var response any = comments
+	if view != "flat" {
+		response = store.CommentTree(comments)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteCommentHandler moves the comment and its replies to the trash, like deletePostHandler.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	comment := getCommentFromContext(r)
+
+	reason, err := app.readDeleteReason(w, r, comment.UserID == user.Id)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID, user.Id, reason); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentsContextMiddleware loads the comment from the url. It has to run after postsContextMiddleware,
+// a comment is only found under the post it belongs to.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetById(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if comment.PostID != getPostFromContext(r).Id {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
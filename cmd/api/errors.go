@@ -22,6 +22,30 @@ func (app *application) conflictResponce(w http.ResponseWriter, r *http.Request,
 
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("precondition failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusPreconditionFailed, err.Error())
+
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnw("precondition required", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusPreconditionRequired, "the If-Match header is required")
+
+}
+
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("payload too large", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("unsupported media type", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+
+}
+
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnf("not found error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 	writeJSONError(w, http.StatusNotFound, "not found")
@@ -54,3 +78,22 @@ func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request
 	writeJSONError(w, http.StatusForbidden, "forbidden")
 
 }
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
+	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Retry-After", retryAfter)
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
+
+}
+
+func (app *application) mfaRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnw("two-factor enrollment required", "method", r.Method, "path", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, "two-factor authentication must be enabled for this account")
+
+}
+
+func (app *application) insufficientScopeResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	app.logger.Warnw("insufficient scope", "method", r.Method, "path", r.URL.Path, "scope", scope)
+	writeJSONError(w, http.StatusForbidden, "token is missing the "+scope+" scope")
+
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// postETag identifies a response with a post: the version, which If-Match compares, followed by a
+// hash of the body, which also changes with the embedded comments, attachment URLs and poll state.
+func postETag(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%d-%s"`, version, hex.EncodeToString(sum[:12]))
+}
+
+// etagVersion returns the post version of a strong ETag made by postETag.
+func etagVersion(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, _, _ := strings.Cut(tag[1:len(tag)-1], "-")
+	v, err := strconv.Atoi(version)
+	return v, err == nil
+}
+
+// etagMatches reports whether etag is one of the comma separated tags of an If-Match or If-None-Match
+// header. Weak tags only match when weak is set, as RFC 9110 asks for If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writePost answers with the post and its ETag, or with 304 when a GET names that ETag in
+// If-None-Match. The body depends on who asks, so shared caches must not keep it.
+func (app *application) writePost(w http.ResponseWriter, r *http.Request, status int, post *store.Post) error {
+	body, err := json.Marshal(struct {
+		Data any `json:"data"`
+	}{Data: post})
+	if err != nil {
+		return err
+	}
+
+	etag := postETag(post.Version, body)
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "private, no-cache")
+	h.Set("Vary", "Authorization")
+
+	if r.Method == http.MethodGet {
+		if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
+
+// checkIfMatch makes sure a change is made to the version of the post the client has seen. Only the
+// version part of the ETag is compared, comments or a new attachment URL are no reason to refuse an
+// edit. It answers 412 when the If-Match header names another version, and 428 when the header is
+// missing while POSTS_REQUIRE_IF_MATCH is set.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, post *store.Post) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if app.config.posts.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if v, ok := etagVersion(tag); ok && v == post.Version {
+			return true
+		}
+	}
+
+	app.preconditionFailedResponse(w, r, fmt.Errorf("the post was modified, its current version is %d", post.Version))
+	return false
+}
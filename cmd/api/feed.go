@@ -25,14 +25,24 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
+	user := getUserFromContext(r)
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(112), fq)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.Id, fq)
 
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+	if err := app.loadPostDetails(ctx, user, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
 
 		app.internalServerError(w, r, err)
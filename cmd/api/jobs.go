@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runPeriodic runs job in the background right away and then every interval. Errors are logged,
+// the next run tries again.
+func (app *application) runPeriodic(name string, interval time.Duration, job func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := job(ctx); err != nil {
+				app.logger.Errorw("background job failed", "job", name, "error", err)
+			}
+			cancel()
+
+			<-ticker.C
+		}
+	}()
+}
+
+// cleanupInvitations purges expired invitations and frees the usernames and emails of accounts
+// that were never activated.
+func (app *application) cleanupInvitations(ctx context.Context) error {
+	invitations, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		return err
+	}
+
+	users, err := app.store.Users.DeleteUnactivated(ctx, app.config.cleanup.unactivatedGrace)
+	if err != nil {
+		return err
+	}
+
+	if invitations > 0 || users > 0 {
+		app.logger.Infow("cleaned up invitations", "expired_invitations", invitations, "unactivated_users", users)
+	}
+	return nil
+}
+
+// publishScheduledPosts publishes the scheduled posts that are due, in batches so a backlog after
+// downtime does not hold one long transaction.
+func (app *application) publishScheduledPosts(ctx context.Context) error {
+	const batch = 100
+
+	var total int64
+	for {
+		n, err := app.store.Posts.PublishDue(ctx, batch)
+		if err != nil {
+			return err
+		}
+		total += n
+		if n < batch {
+			break
+		}
+	}
+
+	if total > 0 {
+		app.logger.Infow("published scheduled posts", "count", total)
+	}
+	return nil
+}
+
+// purgeTrash deletes posts and comments for good once they have been in the trash for the retention period.
+func (app *application) purgeTrash(ctx context.Context) error {
+	before := time.Now().Add(-app.config.cleanup.trashRetention)
+
+	// the files are removed once their rows are gone, a failed purge leaves the attachments intact
+	posts, keys, err := app.store.Posts.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		app.deleteBlob(key)
+	}
+
+	comments, err := app.store.Comments.PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	if posts > 0 || comments > 0 {
+		app.logger.Infow("purged trash", "posts", posts, "comments", comments)
+	}
+	return nil
+}
+
+// cleanupLoginStates removes the OpenID Connect login states that expired before the callback.
+func (app *application) cleanupLoginStates(ctx context.Context) error {
+	n, err := app.store.Identities.DeleteExpiredLoginStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		app.logger.Infow("removed expired login states", "count", n)
+	}
+	return nil
+}
+
+// cleanupAnnouncements removes expired announcements, the feed already ignores them.
+func (app *application) cleanupAnnouncements(ctx context.Context) error {
+	n, err := app.store.Announcements.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		app.logger.Infow("removed expired announcements", "count", n)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"net/http"
+)
+
+// jwksHandler publishes the public signing keys so other services can verify our tokens.
+// The document is served as is (not wrapped in "data") since that is what JWKS clients expect.
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	publisher, ok := app.authenticator.(auth.KeyPublisher)
+	if !ok {
+		app.notFoundResponse(w, r, fmt.Errorf("tokens are signed with a shared secret, there are no public keys"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, publisher.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"github.com/satyamkale27/Go-social.git/internal/blob"
 	db2 "github.com/satyamkale27/Go-social.git/internal/db"
 	"github.com/satyamkale27/Go-social.git/internal/env"
 	mailer2 "github.com/satyamkale27/Go-social.git/internal/mailer"
+	"github.com/satyamkale27/Go-social.git/internal/oidc"
 	store2 "github.com/satyamkale27/Go-social.git/internal/store"
 	"go.uber.org/zap"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -28,6 +34,11 @@ func main() {
 		mail: mailConfig{
 			fromEmail: env.GetString("FROM_EMAIL", ""),
 			exp:       time.Hour * 24 * 3, // 3 days
+			resetExp:  time.Hour,
+			resend: resendConfig{
+				maxPerEmail: env.GetInt("ACTIVATION_RESEND_MAX", 3),
+				window:      time.Hour,
+			},
 			sendGrid: sendgridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
 			},
@@ -39,10 +50,64 @@ func main() {
 				pass: env.GetString("BASIC_AUTH_PASS", "admin"),
 			},
 			token: tokenConfig{
-				secret: env.GetString("TOKEN_SECRET", "example"),
-				expiry: time.Hour * 24 * 3, // 3 days
-				iss:    "gosocial",
+				secret:        env.GetString("TOKEN_SECRET", "example"),
+				expiry:        time.Minute * 15,
+				refreshExpiry: time.Hour * 24 * 30, // 30 days
+				iss:           "gosocial",
+				signing:       env.GetString("TOKEN_SIGNING", "hs256"),
+				keysDir:       env.GetString("TOKEN_KEYS_DIR", "./keys"),
+				activeKID:     env.GetString("TOKEN_ACTIVE_KID", ""),
+				retiredKIDs:   strings.Split(env.GetString("TOKEN_RETIRED_KIDS", ""), ","),
+			},
+			lockout: lockoutConfig{
+				maxAccountFailures: env.GetInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+				maxIPFailures:      env.GetInt("LOGIN_MAX_IP_FAILURES", 20),
+				window:             time.Minute * 15,
+				duration:           time.Minute * 15,
+			},
+			mfa: mfaConfig{
+				issuer:        "GoSocial",
+				pendingExpiry: time.Minute * 5,
+				enforceLevel:  env.GetInt("MFA_ENFORCE_ROLE_LEVEL", 0), // 2 forces moderators and admins
 			},
+			oidc: oidcConfig{
+				name:         env.GetString("OIDC_PROVIDER_NAME", "oidc"),
+				issuer:       env.GetString("OIDC_ISSUER", ""), // empty disables OpenID Connect login
+				clientID:     env.GetString("OIDC_CLIENT_ID", ""),
+				clientSecret: env.GetString("OIDC_CLIENT_SECRET", ""),
+				redirectURL:  env.GetString("OIDC_REDIRECT_URL", "http://localhost:8080/v1/authentication/oidc/callback"),
+				stateExpiry:  time.Minute * 10,
+			},
+		},
+		cleanup: cleanupConfig{
+			interval:         env.GetDuration("CLEANUP_INTERVAL", time.Hour),
+			unactivatedGrace: env.GetDuration("UNACTIVATED_USER_GRACE", time.Hour*24*7), // 7 days
+			trashRetention:   env.GetDuration("TRASH_RETENTION", time.Hour*24*30),       // 30 days
+		},
+		posts: postsConfig{
+			requireIfMatch: env.GetBool("POSTS_REQUIRE_IF_MATCH", false),
+			maxPinned:      env.GetInt("POSTS_MAX_PINNED", 3),
+		},
+		media: mediaConfig{
+			storage:  env.GetString("MEDIA_STORAGE", "local"),
+			localDir: env.GetString("MEDIA_LOCAL_DIR", "./uploads"),
+			s3: s3Config{
+				endpoint:  env.GetString("MEDIA_S3_ENDPOINT", "http://localhost:9000"),
+				region:    env.GetString("MEDIA_S3_REGION", "us-east-1"),
+				bucket:    env.GetString("MEDIA_S3_BUCKET", "gosocial"),
+				accessKey: env.GetString("MEDIA_S3_ACCESS_KEY", ""),
+				secretKey: env.GetString("MEDIA_S3_SECRET_KEY", ""),
+			},
+			maxUploadSize: int64(env.GetInt("MEDIA_MAX_UPLOAD_SIZE", 10<<20)), // 10 MB
+			maxPerPost:    env.GetInt("MEDIA_MAX_PER_POST", 4),
+			urlSecret:     env.GetString("MEDIA_URL_SECRET", ""),
+			urlExpiry:     env.GetDuration("MEDIA_URL_EXPIRY", time.Minute*15),
+		},
+		scheduler: schedulerConfig{
+			interval: env.GetDuration("POST_SCHEDULER_INTERVAL", time.Second*30),
+		},
+		tags: tagsConfig{
+			refreshInterval: env.GetDuration("TAG_COUNTS_REFRESH_INTERVAL", time.Minute*5),
 		},
 	}
 
@@ -66,17 +131,54 @@ func main() {
 
 	mailer := mailer2.NewSendgrid(cfg.mail.sendGrid.apiKey, cfg.mail.fromEmail)
 
-	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.iss, cfg.auth.token.iss)
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if cfg.media.urlSecret == "" {
+		if cfg.env == "production" {
+			logger.Fatal("MEDIA_URL_SECRET must be set in production")
+		}
+		// a default secret would be public, a random one only lives as long as the process
+		if cfg.media.urlSecret, err = randomSecret(); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Warn("MEDIA_URL_SECRET is not set, attachment URLs stop working on restart and only work on this instance")
+	}
+
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	app := &application{
 		config:        cfg,
 		store:         store,
 		logger:        logger,
 		mailer:        mailer,
-		authenticator: jwtAuthenticator,
+		authenticator: authenticator,
+		blobs:         blobs,
+	}
+
+	if cfg.auth.oidc.issuer != "" {
+		app.oidc = oidc.NewProvider(oidc.Config{
+			Name:         cfg.auth.oidc.name,
+			Issuer:       cfg.auth.oidc.issuer,
+			ClientID:     cfg.auth.oidc.clientID,
+			ClientSecret: cfg.auth.oidc.clientSecret,
+			RedirectURL:  cfg.auth.oidc.redirectURL,
+		})
+		app.runPeriodic("login state cleanup", cfg.cleanup.interval, app.cleanupLoginStates)
 	}
 	os.LookupEnv("PATH")
 
+	app.runPeriodic("invitation cleanup", cfg.cleanup.interval, app.cleanupInvitations)
+	app.runPeriodic("post scheduler", cfg.scheduler.interval, app.publishScheduledPosts)
+	app.runPeriodic("trash purge", cfg.cleanup.interval, app.purgeTrash)
+	app.runPeriodic("announcement cleanup", cfg.cleanup.interval, app.cleanupAnnouncements)
+	app.runPeriodic("tag counts", cfg.tags.refreshInterval, app.store.Tags.Refresh)
+
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 
@@ -86,3 +188,50 @@ func main() {
 		This is why you don't need to call run(app) explicitly.
 	*/
 }
+
+func newAuthenticator(cfg config) (auth.Authenticator, error) {
+	token := cfg.auth.token
+
+	switch token.signing {
+	case "hs256":
+		if cfg.env == "production" && token.secret == "example" {
+			return nil, fmt.Errorf("TOKEN_SECRET must be set in production")
+		}
+		return auth.NewJWTAuthenticator(token.secret, token.iss, token.iss, token.expiry, token.refreshExpiry), nil
+	case "asymmetric":
+		keys, err := auth.LoadSigningKeys(token.keysDir, token.retiredKIDs)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewAsymmetricAuthenticator(keys, token.activeKID, token.iss, token.iss, token.expiry, token.refreshExpiry)
+	default:
+		return nil, fmt.Errorf("unknown TOKEN_SIGNING %q, expected hs256 or asymmetric", token.signing)
+	}
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newBlobStore(cfg config) (blob.BlobStore, error) {
+	media := cfg.media
+
+	switch media.storage {
+	case "local":
+		return blob.NewLocal(media.localDir)
+	case "s3":
+		return blob.NewS3(blob.S3Config{
+			Endpoint:  media.s3.endpoint,
+			Region:    media.s3.region,
+			Bucket:    media.s3.bucket,
+			AccessKey: media.s3.accessKey,
+			SecretKey: media.s3.secretKey,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_STORAGE %q, expected local or s3", media.storage)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+)
+
+// getMentionsHandler lists the published posts that mention the user, newest first.
+func (app *application) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.PaginatedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Posts.GetMentioning(r.Context(), getUserFromContext(r).Id, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	list := make([]*store.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i]
+	}
+	if err := app.loadPostDetails(r.Context(), getUserFromContext(r), list...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+type mfaExemptKey string
+
+const mfaExemptCtx mfaExemptKey = "mfaExempt"
+
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// enrollTOTPHandler starts 2FA enrollment. The secret stays inactive until a code generated from it is confirmed.
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.SetPendingSecret(r.Context(), user.Id, secret); err != nil {
+		switch err {
+		case store.ErrMFAAlreadyEnabled:
+			app.conflictResponce(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	enrollment := TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, app.config.auth.mfa.issuer, user.Email),
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// confirmTOTPHandler enables 2FA once the user proves their app generates valid codes, and returns
+// the recovery codes. They are only ever shown here, we keep their hashes.
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	totp, err := app.store.MFA.GetTOTP(ctx, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if totp.Enabled {
+		app.conflictResponce(w, r, store.ErrMFAAlreadyEnabled)
+		return
+	}
+	if totp.Secret == "" {
+		app.badRequestResponse(w, r, fmt.Errorf("two-factor enrollment has not been started"))
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(code)
+	}
+
+	if err := app.store.MFA.EnableTOTP(ctx, user.Id, totp.Secret, step, hashes); err != nil {
+		switch {
+		case errors.Is(err, store.ErrMFAAlreadyEnabled), errors.Is(err, store.ErrMFASecretReplaced):
+			app.conflictResponce(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	response := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if app.mfaEnforcedFor(user) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, user.Id, payload.Code, "")
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+
+	if err := app.store.MFA.DisableTOTP(ctx, user.Id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type VerifyMFAPayload struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=20"`
+}
+
+// verifyMFAHandler is the second step of a login with 2FA: it trades the mfa_pending token from
+// createTokenHandler and a TOTP or recovery code for a token pair.
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	if claims["typ"] != auth.TokenTypeMFAPending {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("not an mfa token"))
+		return
+	}
+
+	userid, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("token is missing jti claim"))
+		return
+	}
+	revoked, err := app.store.Revocations.IsRevoked(ctx, jti, userid, tokenGeneration(claims))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if revoked {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("mfa token already used"))
+		return
+	}
+
+	user, err := app.store.Users.GetById(ctx, userid)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// guessing codes counts against the same lockout as guessing passwords
+	email := strings.ToLower(user.Email)
+	ip := clientIP(r)
+	lockedUntil, err := app.loginLockedUntil(ctx, email, ip)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+		app.rateLimitExceededResponse(w, r, strconv.Itoa(retryAfter))
+		return
+	}
+
+	ok, err := app.verifySecondFactor(ctx, user.Id, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		app.loginFailed(w, r, email, ip, fmt.Errorf("invalid second factor"))
+		return
+	}
+
+	// the mfa token is single-use
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Revocations.Revoke(ctx, jti, user.Id, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.LoginAttempts.Reset(ctx, store.LoginScopeAccount, email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.startSession(r, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// issueMFAToken returns the short-lived token that stands for "password verified, second factor pending".
+func (app *application) issueMFAToken(ctx context.Context, user *store.User) (string, error) {
+	generation, err := app.store.Revocations.Generation(ctx, user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": user.Id,
+		"exp": now.Add(app.config.auth.mfa.pendingExpiry).Unix(),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.iss,
+		"jti": uuid.New().String(),
+		"typ": auth.TokenTypeMFAPending,
+		"gen": generation,
+	}
+	return app.authenticator.GenerateToken(claims)
+}
+
+// verifySecondFactor checks a TOTP code, refusing replays, or else burns a recovery code.
+func (app *application) verifySecondFactor(ctx context.Context, userId int64, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		totp, err := app.store.MFA.GetTOTP(ctx, userId)
+		if err != nil {
+			return false, err
+		}
+		if !totp.Enabled {
+			return false, nil
+		}
+		step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return app.store.MFA.UseTOTPStep(ctx, userId, step)
+	}
+
+	if recoveryCode != "" {
+		hash := auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode))
+		return app.store.MFA.UseRecoveryCode(ctx, userId, hash)
+	}
+
+	return false, nil
+}
+
+// mfaEnforcedFor reports whether the user's role is privileged enough to require 2FA.
+func (app *application) mfaEnforcedFor(user *store.User) bool {
+	level := app.config.auth.mfa.enforceLevel
+	return level > 0 && user.Role.Level >= int64(level)
+}
+
+// allowWithoutMFA marks routes a user who is forced into 2FA can still reach before enrolling.
+func (app *application) allowWithoutMFA(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), mfaExemptCtx, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
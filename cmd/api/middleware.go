@@ -5,12 +5,22 @@ import (
 	"encoding/base64"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
 	"github.com/satyamkale27/Go-social.git/internal/store"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+type claimsKey string
+
+const claimsCtx claimsKey = "claims"
+
+type scopesKey string
+
+const scopesCtx scopesKey = "scopes"
+
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -27,6 +37,12 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		token := parts[1]
 
+		// personal access tokens carry their own scopes, a JWT from a login has access to everything
+		if strings.HasPrefix(token, auth.PersonalAccessTokenPrefix) {
+			app.authenticatePersonalAccessToken(w, r, next, token)
+			return
+		}
+
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
@@ -34,6 +50,10 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		claims := jwtToken.Claims.(jwt.MapClaims)
+		if claims["typ"] != auth.TokenTypeAccess {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("not an access token"))
+			return
+		}
 
 		userid, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
 		if err != nil {
@@ -43,16 +63,92 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		ctx := r.Context()
 
+		// reject tokens revoked by a logout before they expire
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("token is missing jti claim"))
+			return
+		}
+		revoked, err := app.store.Revocations.IsRevoked(ctx, jti, userid, tokenGeneration(claims))
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if revoked {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has been revoked"))
+			return
+		}
+
+		// tokens of a session ended from another device stop working right away
+		sessionID, _ := claims["sid"].(string)
+		if sessionID == "" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("token is missing sid claim"))
+			return
+		}
+		active, err := app.store.Sessions.Seen(ctx, sessionID, userid)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !active {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("session has been revoked"))
+			return
+		}
+
 		user, err := app.store.Users.GetById(ctx, userid)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		// privileged accounts forced into 2FA can only reach the enrollment routes until they enable it
+		exempt, _ := ctx.Value(mfaExemptCtx).(bool)
+		if !exempt && !user.TOTPEnabled && app.mfaEnforcedFor(user) {
+			app.mfaRequiredResponse(w, r)
+			return
 		}
 
 		ctx = context.WithValue(ctx, "user", user)
+		ctx = context.WithValue(ctx, claimsCtx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (app *application) authenticatePersonalAccessToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	ctx := r.Context()
+
+	pat, err := app.store.PersonalAccessTokens.GetByToken(ctx, auth.HashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetById(ctx, pat.UserID)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	if !user.TOTPEnabled && app.mfaEnforcedFor(user) {
+		app.mfaRequiredResponse(w, r)
+		return
+	}
+
+	if err := app.store.PersonalAccessTokens.Touch(ctx, pat.Id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx = context.WithValue(ctx, "user", user)
+	ctx = context.WithValue(ctx, scopesCtx, pat.Scopes)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -143,6 +239,30 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	})
 }
 
+// checkCommentOwnership works like checkPostOwnership for the comment in the request context.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		comment := getCommentFromContext(r)
+
+		if comment.UserID == user.Id {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRoleprecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) checkRoleprecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
 
 	role, err := app.store.Roles.GetByName(ctx, roleName)
@@ -151,3 +271,60 @@ func (app *application) checkRoleprecedence(ctx context.Context, user *store.Use
 	}
 	return user.Role.Level >= role.Level, nil
 }
+
+// requireRole only lets users whose role is at least requiredRole through.
+func (app *application) requireRole(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getUserFromContext(r)
+
+			allowed, err := app.checkRoleprecedence(r.Context(), user, requiredRole)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenGeneration returns the "gen" claim of a token, tokens issued before it existed are generation 0.
+func tokenGeneration(claims jwt.MapClaims) int64 {
+	gen, _ := claims["gen"].(float64)
+	return int64(gen)
+}
+
+func getClaimsFromContext(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(claimsCtx).(jwt.MapClaims)
+	return claims
+}
+
+// requireScope lets personal access tokens through only when they were granted scope.
+// Tokens from a login are not limited by scopes.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, limited := r.Context().Value(scopesCtx).([]string)
+			if limited && !slices.Contains(scopes, scope) {
+				app.insufficientScopeResponse(w, r, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSession keeps personal access tokens away from routes that manage the account itself.
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, limited := r.Context().Value(scopesCtx).([]string); limited {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/oidc"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// oidcStateCookie holds the state of a login in the browser that started it, so a callback URL
+// handed to somebody else does not log them into the account of whoever started the login.
+const oidcStateCookie = "oidc_state"
+
+func (app *application) setStateCookie(w http.ResponseWriter, state string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/v1/authentication/oidc",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(app.config.auth.oidc.redirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode, // the provider redirects back with a top level GET
+	})
+}
+
+// oidcLoginHandler starts a login at the OpenID Connect provider (authorization code flow with PKCE).
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	loginState := &store.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Expiry:       time.Now().Add(app.config.auth.oidc.stateExpiry),
+	}
+	if err := app.store.Identities.CreateLoginState(ctx, loginState); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	authURL, err := app.oidc.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.setStateCookie(w, state, app.config.auth.oidc.stateExpiry)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler finishes the login: it verifies the ID token, finds or links the local account
+// by provider subject or verified email, and hands out the usual Go-social tokens.
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	if providerErr := qs.Get("error"); providerErr != "" {
+		app.badRequestResponse(w, r, fmt.Errorf("provider returned %s: %s", providerErr, qs.Get("error_description")))
+		return
+	}
+
+	state := qs.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		app.badRequestResponse(w, r, fmt.Errorf("the login was not started in this browser"))
+		return
+	}
+	app.setStateCookie(w, "", -1)
+
+	ctx := r.Context()
+
+	loginState, err := app.store.Identities.ConsumeLoginState(ctx, state)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("invalid or expired state"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	claims, err := app.oidc.Exchange(ctx, qs.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.userForIdentity(r, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			app.unauthorizedErrorResponse(w, r, err)
+		case errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictResponce(w, r, fmt.Errorf("an account with this email is waiting for activation"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// logging in through the provider must not skip our own second factor
+	if user.TOTPEnabled {
+		mfaToken, err := app.issueMFAToken(ctx, user)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		challenge := MFAChallenge{MFARequired: true, MFAToken: mfaToken}
+		if err := app.jsonResponse(w, http.StatusOK, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.startSession(r, user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var errUnverifiedEmail = errors.New("the provider did not return a verified email")
+
+func (app *application) userForIdentity(r *http.Request, claims *oidc.Claims) (*store.User, error) {
+	ctx := r.Context()
+	provider := app.oidc.Name()
+
+	userId, err := app.store.Identities.GetUserID(ctx, provider, claims.Subject)
+	switch {
+	case err == nil:
+		return app.store.Users.GetById(ctx, userId)
+	case errors.Is(err, store.ErrNotFound):
+	default:
+		return nil, err
+	}
+
+	// first login with this identity: only a verified email may be trusted to link accounts
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	identity := &store.UserIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		identity.UserID = user.Id
+		if err := app.store.Identities.Link(ctx, identity); err != nil {
+			return nil, err
+		}
+		app.logger.Infow("linked identity to existing account", "provider", provider, "user_id", user.Id)
+		return app.store.Users.GetById(ctx, user.Id)
+	case errors.Is(err, store.ErrNotFound):
+	default:
+		return nil, err
+	}
+
+	user = &store.User{
+		Username: usernameFromClaims(claims),
+		Email:    claims.Email,
+	}
+	// nobody knows this password, the account logs in through the provider or after a password reset
+	if err := user.Password.Set(uuid.New().String()); err != nil {
+		return nil, err
+	}
+
+	base := user.Username
+	for attempt := 0; ; attempt++ {
+		err := app.store.Identities.CreateUserWithIdentity(ctx, user, identity)
+		if errors.Is(err, store.ErrDuplicateUsername) && attempt < 5 {
+			user.Username = fmt.Sprintf("%s_%04d", base, rand.Intn(10000))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	return app.store.Users.GetById(ctx, user.Id)
+}
+
+func usernameFromClaims(claims *oidc.Claims) string {
+	username := claims.PreferredUsername
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	username = usernameDisallowed.ReplaceAllString(username, "")
+	if len(username) > 90 {
+		username = username[:90]
+	}
+	if username == "" {
+		username = "user"
+	}
+	return username
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"github.com/satyamkale27/Go-social.git/internal/mailer"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strings"
+)
+
+// pendingPasswordResets bounds the password resets handled in the background, requests beyond it
+// are answered the same way but dropped.
+var pendingPasswordResets = make(chan struct{}, 64)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// forgotPasswordHandler mails a reset link. It answers the same way whether or not the email
+// belongs to an account, so it cannot be used to find out who is registered: the account is looked
+// up and the mail sent after the response, which takes the same time for every email.
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	select {
+	case pendingPasswordResets <- struct{}{}:
+		go func() {
+			defer func() { <-pendingPasswordResets }()
+			app.sendPasswordReset(payload.Email)
+		}()
+	default:
+		app.logger.Warnw("too many pending password resets, request dropped")
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// sendPasswordReset creates a reset token for the account of email and mails the link, at most
+// ACTIVATION_RESEND_MAX times per email and window. It runs in the background of forgotPasswordHandler,
+// so the limit does not show in the response and failures can only be logged.
+func (app *application) sendPasswordReset(email string) {
+	ctx := context.Background()
+	key := strings.ToLower(email)
+	limit := app.config.mail.resend
+
+	lockedUntil, err := app.store.LoginAttempts.LockedUntil(ctx, store.LoginScopePasswordReset, key)
+	if err != nil {
+		app.logger.Errorw("error checking password reset limit", "error", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		app.logger.Infow("password reset limit reached", "locked_until", lockedUntil)
+		return
+	}
+	if err := app.store.LoginAttempts.RegisterFailure(ctx, store.LoginScopePasswordReset, key, limit.maxPerEmail, limit.window, limit.window); err != nil {
+		app.logger.Errorw("error counting password reset", "error", err)
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.logger.Infow("password reset requested for unknown email")
+		default:
+			app.logger.Errorw("error looking up account for password reset", "error", err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+	hashToken := auth.HashToken(plainToken)
+
+	if err := app.store.Users.CreatePasswordReset(ctx, user.Id, hashToken, app.config.mail.resetExp); err != nil {
+		app.logger.Errorw("error creating password reset", "error", err)
+		return
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password/%s", app.config.frontendUrl, plainToken)
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  resetURL,
+		ExpiresIn: app.config.mail.resetExp.String(),
+	}
+
+	status, err := app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Errorw("error sending password reset mail", "error", err)
+		return
+	}
+	app.logger.Infow("Email sent", "status code", status)
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := &store.User{}
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Users.ResetPassword(ctx, payload.Token, user); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// whoever knew the old password must not stay logged in
+	if err := app.revokeAllSessions(ctx, user.Id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.LoginAttempts.Reset(ctx, store.LoginScopeAccount, strings.ToLower(user.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
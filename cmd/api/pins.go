@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pinPostHandler pins one of the user's own published posts to their profile.
+func (app *application) pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if post.UserID != user.Id {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Posts.Pin(r.Context(), user.Id, post.Id, app.config.posts.maxPinned); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("only published posts can be pinned"))
+		case errors.Is(err, store.ErrTooManyPinned):
+			app.conflictResponce(w, r, fmt.Errorf("at most %d posts can be pinned, unpin one first", app.config.posts.maxPinned))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Posts.Unpin(r.Context(), user.Id, post.Id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type AnnouncePayload struct {
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+}
+
+// announcePostHandler puts the post at the top of every feed until it expires. Announcing it again
+// changes the expiry.
+func (app *application) announcePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	var payload AnnouncePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !payload.ExpiresAt.After(time.Now()) {
+		app.badRequestResponse(w, r, fmt.Errorf("expires_at must be in the future"))
+		return
+	}
+
+	announcement := &store.Announcement{
+		PostID:    post.Id,
+		CreatedBy: getUserFromContext(r).Id,
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if err := app.store.Announcements.Set(r.Context(), announcement); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("only published public posts can be announced"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, announcement); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) removeAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	if err := app.store.Announcements.Delete(r.Context(), post.Id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userProfile is what other users see of an account, without its email or role.
+type userProfile struct {
+	Id        int64                `json:"id"`
+	Username  string               `json:"username"`
+	CreatedAt string               `json:"created_at"`
+	Posts     []store.AllUserPosts `json:"posts"` // pinned posts first
+}
+
+// getUserProfileHandler shows a user with the posts the requesting user may see.
+func (app *application) getUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	posts, err := app.store.Posts.GetAllUserPosts(ctx, user.Id, viewer.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	list := make([]*store.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i].Post
+	}
+	if err := app.loadPostDetails(ctx, viewer, list...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	profile := userProfile{
+		Id:        user.Id,
+		Username:  user.Username,
+		CreatedAt: user.CreatedAt,
+		Posts:     posts,
+	}
+	if profile.Posts == nil {
+		profile.Posts = []store.AllUserPosts{}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type PollPayload struct {
+	Options  []string  `json:"options" validate:"min=2,max=6,dive,required,max=100"`
+	Multiple bool      `json:"multiple"`
+	ClosesAt time.Time `json:"closes_at" validate:"required"`
+}
+
+// newPoll checks the poll of a post being created. It has to close in the future, and after the
+// post is published when it is scheduled.
+func newPoll(payload *PollPayload, publishAt *time.Time) (*store.Poll, error) {
+	poll := &store.Poll{
+		Multiple: payload.Multiple,
+		ClosesAt: payload.ClosesAt,
+	}
+
+	seen := map[string]bool{}
+	for _, text := range payload.Options {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, fmt.Errorf("poll options cannot be empty")
+		}
+		if seen[strings.ToLower(text)] {
+			return nil, fmt.Errorf("poll options must be different")
+		}
+		seen[strings.ToLower(text)] = true
+		poll.Options = append(poll.Options, store.PollOption{Text: text})
+	}
+
+	opensAt := time.Now()
+	if publishAt != nil {
+		opensAt = *publishAt
+	}
+	if !poll.ClosesAt.After(opensAt) {
+		return nil, fmt.Errorf("closes_at must be after the post is published")
+	}
+	return poll, nil
+}
+
+type VotePayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"required,min=1,max=6"`
+}
+
+// votePollHandler records the vote of the user and answers with the poll, results included.
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	var payload VotePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the author can see a draft, but nobody votes before it is published
+	if post.Status != store.PostStatusPublished {
+		app.badRequestResponse(w, r, fmt.Errorf("the post is not published yet"))
+		return
+	}
+
+	optionIDs := slices.Clone(payload.OptionIDs)
+	slices.Sort(optionIDs)
+	optionIDs = slices.Compact(optionIDs)
+
+	ctx := r.Context()
+	if err := app.store.Polls.Vote(ctx, post.Id, user.Id, optionIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("the post has no poll"))
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponce(w, r, fmt.Errorf("you already voted"))
+		case errors.Is(err, store.ErrPollClosed):
+			app.badRequestResponse(w, r, fmt.Errorf("the poll is closed"))
+		case errors.Is(err, store.ErrInvalidVote):
+			app.badRequestResponse(w, r, fmt.Errorf("pick one option of this poll, or several if it allows multiple choices"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadPolls(ctx, user, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post.Poll); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// loadPolls sets the polls of the posts as the user sees them.
+func (app *application) loadPolls(ctx context.Context, user *store.User, posts ...*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.Id
+	}
+
+	polls, err := app.store.Polls.GetByPostIDs(ctx, ids, user.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Poll = polls[p.Id]
+	}
+	return nil
+}
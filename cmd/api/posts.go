@@ -7,7 +7,9 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/satyamkale27/Go-social.git/internal/store"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 )
 
 type postKey string
@@ -15,10 +17,26 @@ type postKey string
 const postCtx postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
-	User_id int      `json:"user_id"`
+	Title        string       `json:"title" validate:"required,max=100"`
+	Content      string       `json:"content" validate:"required,max=1000"`
+	Tags         []string     `json:"tags"` // normalized, see store.NormalizeTags
+	User_id      int          `json:"user_id"`
+	QuotedPostID *int64       `json:"quoted_post_id" validate:"omitempty,min=1"`                   // set to quote another post
+	Status       string       `json:"status" validate:"omitempty,oneof=draft scheduled published"` // defaults to published
+	PublishAt    *time.Time   `json:"publish_at" validate:"required_if=Status scheduled"`
+	Visibility   string       `json:"visibility" validate:"omitempty,oneof=public followers private"` // defaults to public
+	Poll         *PollPayload `json:"poll"`
+}
+
+// validatePublishing checks the publish_at of a post that is being scheduled and drops it for any other status.
+func validatePublishing(status string, publishAt *time.Time) (*time.Time, error) {
+	if status != store.PostStatusScheduled {
+		return nil, nil
+	}
+	if publishAt == nil || !publishAt.After(time.Now()) {
+		return nil, fmt.Errorf("publish_at must be in the future")
+	}
+	return publishAt, nil
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,18 +71,71 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	tags, err := store.NormalizeTags(payload.Tags)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Status == "" {
+		payload.Status = store.PostStatusPublished
+	}
+	publishAt, err := validatePublishing(payload.Status, payload.PublishAt)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var poll *store.Poll
+	if payload.Poll != nil {
+		if poll, err = newPoll(payload.Poll, publishAt); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
 	user := getUserFromContext(r) // get the user that is currently authenticated
 
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.Id,
+		Title:        payload.Title,
+		Content:      payload.Content,
+		Tags:         tags,
+		UserID:       user.Id,
+		QuotedPostID: payload.QuotedPostID,
+		Status:       payload.Status,
+		PublishAt:    publishAt,
+		Visibility:   payload.Visibility,
+		Poll:         poll,
 	}
 	ctx := r.Context()
 
+	if payload.QuotedPostID != nil {
+		// drafts and scheduled posts of other users cannot be quoted before they are published
+		quoted, err := app.store.Posts.GetById(ctx, *payload.QuotedPostID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+		visible := false
+		if err == nil && quoted.Status == store.PostStatusPublished {
+			if visible, err = app.canViewPost(ctx, quoted, user); err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+		if !visible {
+			app.badRequestResponse(w, r, fmt.Errorf("quoted post not found"))
+			return
+		}
+	}
+
 	if err := app.store.Posts.Create(ctx, post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("quoted post not found"))
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -94,14 +165,24 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post := getPostFromContext(r)
 
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.Id)
+	// only the first page of threads, the rest is paged through /comments
+	q := store.CommentQuery{
+		PaginatedQuery: store.PaginatedQuery{Limit: 20, Sort: "asc"},
+		Replies:        3,
+	}
+	if err := app.loadPostDetails(r.Context(), getUserFromContext(r), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	comments, err := app.store.Comments.GetPageByPostID(r.Context(), post.Id, q)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	post.Comment = comments
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	if err := app.writePost(w, r, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -109,9 +190,18 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) getAllPostsHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
-	posts, err := app.store.Posts.GetAllUserPosts(r.Context(), user.Id)
+	posts, err := app.store.Posts.GetAllUserPosts(r.Context(), user.Id, user.Id)
 	if err != nil {
 		app.internalServerError(w, r, err)
+		return
+	}
+	list := make([]*store.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i].Post
+	}
+	if err := app.loadPostDetails(r.Context(), user, list...); err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
 	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
 		app.internalServerError(w, r, err)
@@ -120,18 +210,26 @@ func (app *application) getAllPostsHandler(w http.ResponseWriter, r *http.Reques
 
 }
 
+// deletePostHandler moves the post to the trash. An admin removing someone else's post has to say why.
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "postId")
-	id, err := strconv.ParseInt(idParam, 10, 64)
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if !app.checkIfMatch(w, r, post) {
+		return
+	}
+
+	reason, err := app.readDeleteReason(w, r, post.UserID == user.Id)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
-	if err := app.store.Posts.Delete(ctx, id); err != nil {
+	if err := app.store.Posts.Delete(ctx, post.Id, post.Version, user.Id, reason); err != nil {
 		switch {
-
+		case errors.Is(err, store.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, fmt.Errorf("the post was modified while deleting it, reload it and try again"))
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
@@ -144,16 +242,52 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string    `json:"title" validate:"omitempty,max=100"`
+	Content    *string    `json:"content" validate:"omitempty,max=1000"`
+	Status     *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at"`
+	Visibility *string    `json:"visibility" validate:"omitempty,oneof=public followers private"`
+
+	// either replace all tags with Tags, or change them with AddTags and RemoveTags
+	Tags       *[]string `json:"tags"`
+	AddTags    []string  `json:"add_tags"`
+	RemoveTags []string  `json:"remove_tags"`
+}
+
+// updatedTags applies the tag changes of the payload to the current tags of a post.
+func updatedTags(current []string, payload UpdatePostPayload) ([]string, error) {
+	if payload.Tags != nil && (len(payload.AddTags) > 0 || len(payload.RemoveTags) > 0) {
+		return nil, fmt.Errorf("tags cannot be combined with add_tags or remove_tags")
+	}
+	if payload.Tags != nil {
+		return store.NormalizeTags(*payload.Tags)
+	}
+
+	removed, err := store.NormalizeTags(payload.RemoveTags)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, tag := range current {
+		if !slices.Contains(removed, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return store.NormalizeTags(append(tags, payload.AddTags...))
 }
 
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromContext(r) // post received from context not by querying database
 
+	if !app.checkIfMatch(w, r, post) {
+		return
+	}
+
 	var payload UpdatePostPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	if err := Validate.Struct(payload); err != nil {
@@ -167,6 +301,35 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
+	if payload.Tags != nil || len(payload.AddTags) > 0 || len(payload.RemoveTags) > 0 {
+		tags, err := updatedTags(post.Tags, payload)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		post.Tags = tags
+	}
+	if payload.Status != nil {
+		if post.Status == store.PostStatusPublished && *payload.Status != store.PostStatusPublished {
+			app.badRequestResponse(w, r, fmt.Errorf("a published post cannot be unpublished"))
+			return
+		}
+		post.Status = *payload.Status
+	}
+	if payload.PublishAt != nil {
+		post.PublishAt = payload.PublishAt
+	}
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+	if payload.Status != nil || payload.PublishAt != nil {
+		publishAt, err := validatePublishing(post.Status, post.PublishAt)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		post.PublishAt = publishAt
+	}
 
 	/*
 
@@ -271,12 +434,18 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 
 	*/
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
-		app.internalServerError(w, r, err)
+	user := getUserFromContext(r)
+	if err := app.store.Posts.Update(r.Context(), post, user.Id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.conflictResponce(w, r, fmt.Errorf("the post was modified by another request, reload it and try again"))
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	if err := app.writePost(w, r, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 
 	}
@@ -303,6 +472,17 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// a post the user may not see does not exist for them, a 403 would tell it does
+		visible, err := app.canViewPost(ctx, post, getUserFromContext(r))
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 
 		/*
@@ -362,6 +542,34 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// canViewPost applies the rules the store uses for listings to a single post: unpublished posts are
+// only visible to their author, and so are private posts, followers-only posts also to the followers.
+func (app *application) canViewPost(ctx context.Context, post *store.Post, user *store.User) (bool, error) {
+	switch {
+	case user != nil && user.Id == post.UserID:
+		return true, nil
+	case user == nil || post.Status != store.PostStatusPublished:
+		return false, nil
+	}
+
+	switch post.Visibility {
+	case store.PostVisibilityPublic:
+		return true, nil
+	case store.PostVisibilityFollowers:
+		return app.store.Followers.IsFollowing(ctx, user.Id, post.UserID)
+	default:
+		return false, nil
+	}
+}
+
+// loadPostDetails sets what is loaded separately for a page of posts: attachments and polls.
+func (app *application) loadPostDetails(ctx context.Context, user *store.User, posts ...*store.Post) error {
+	if err := app.loadAttachments(ctx, posts...); err != nil {
+		return err
+	}
+	return app.loadPolls(ctx, user, posts...)
+}
+
 func getPostFromContext(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"slices"
+)
+
+// reactionKinds are the reactions a post can get, "like" being the plain like button.
+var reactionKinds = []string{"like", "love", "haha", "wow", "sad", "angry"}
+
+// addReactionHandler reacts to the post, it is idempotent so a double click does no harm.
+func (app *application) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := app.reactionKindParam(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Reactions.Add(r.Context(), post.Id, user.Id, kind); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := app.reactionKindParam(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Reactions.Remove(r.Context(), post.Id, user.Id, kind); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) reactionKindParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	kind := chi.URLParam(r, "kind")
+	if !slices.Contains(reactionKinds, kind) {
+		app.badRequestResponse(w, r, fmt.Errorf("unknown reaction %q, expected one of %v", kind, reactionKinds))
+		return "", false
+	}
+	return kind, true
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+)
+
+// repostHandler shares the post with the user's followers, it shows up in their feeds attributed to the user.
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Reposts.Add(r.Context(), user.Id, post.Id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) undoRepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	if err := app.store.Reposts.Remove(r.Context(), user.Id, post.Id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"github.com/satyamkale27/Go-social.git/internal/textdiff"
+	"net/http"
+	"strconv"
+)
+
+// getRevisionsHandler lists the previous versions of the post, newest first.
+func (app *application) getRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	q, err := store.PaginatedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	revisions, err := app.store.Revisions.GetByPostID(r.Context(), post.Id, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type revisionDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Title   []textdiff.Op `json:"title"`
+	Content []textdiff.Op `json:"content"`
+}
+
+// diffRevisionsHandler compares two versions of the post, ?from=&to= default to the last edit.
+func (app *application) diffRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	to, err := versionQueryParam(r, "to", post.Version)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	from, err := versionQueryParam(r, "from", to-1)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var versions [2]*store.PostRevision
+	for i, version := range []int{from, to} {
+		versions[i], err = app.postVersion(r, post, version)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, fmt.Errorf("version %d not found", version))
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	diff := revisionDiff{
+		From:    from,
+		To:      to,
+		Title:   textdiff.Lines(versions[0].Title, versions[1].Title),
+		Content: textdiff.Lines(versions[0].Content, versions[1].Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, diff); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revertPostHandler restores the title and content of an earlier version. The revert is an edit
+// like any other, so the version it replaces ends up in the history too.
+func (app *application) revertPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromContext(r)
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if version == post.Version {
+		app.badRequestResponse(w, r, fmt.Errorf("version %d is the current version", version))
+		return
+	}
+
+	revision, err := app.store.Revisions.Get(r.Context(), post.Id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, post) {
+		return
+	}
+
+	post.Title = revision.Title
+	post.Content = revision.Content
+
+	if err := app.store.Posts.Update(r.Context(), post, user.Id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.conflictResponce(w, r, fmt.Errorf("the post was edited while reverting, try again"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.writePost(w, r, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// postVersion returns the given version of the post, the current one coming from the post itself.
+func (app *application) postVersion(r *http.Request, post *store.Post, version int) (*store.PostRevision, error) {
+	if version == post.Version {
+		return &store.PostRevision{
+			PostID:   post.Id,
+			Version:  post.Version,
+			Title:    post.Title,
+			Content:  post.Content,
+			EditedAt: post.UpdatedAt,
+		}, nil
+	}
+	return app.store.Revisions.Get(r.Context(), post.Id, version)
+}
+
+func versionQueryParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a version number", name)
+	}
+	return version, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+)
+
+// listSessionsHandler shows the devices the user is logged in on, marking the one making the request.
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	sessions, err := app.store.Sessions.GetByUserID(r.Context(), user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	currentID, _ := getClaimsFromContext(r)["sid"].(string)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == currentID
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, sessions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revokeSessionHandler logs one device out: its refresh tokens are revoked and its access tokens
+// are refused from the next request on.
+func (app *application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "sessionId"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Sessions.Revoke(r.Context(), user.Id, id.String()); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
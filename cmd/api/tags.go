@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+)
+
+// getTagsHandler lists the most used tags, ?q= autocompletes a tag from its first characters.
+func (app *application) getTagsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := store.TagQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tags, err := app.store.Tags.Search(r.Context(), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// scopes a personal access token can be granted, checked per route with requireScope
+const (
+	scopePostsRead  = "posts:read"
+	scopePostsWrite = "posts:write"
+	scopeFeedRead   = "feed:read"
+	scopeUsersRead  = "users:read"
+	scopeUsersWrite = "users:write"
+)
+
+type CreatePersonalAccessTokenPayload struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write feed:read users:read users:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type PersonalAccessTokenWithToken struct {
+	*store.PersonalAccessToken
+	Token string `json:"token"` // only returned once, when the token is created
+}
+
+func (app *application) createPersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreatePersonalAccessTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if payload.ExpiresAt != nil && payload.ExpiresAt.Before(time.Now()) {
+		app.badRequestResponse(w, r, fmt.Errorf("expires_at must be in the future"))
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	plainToken, err := auth.GeneratePersonalAccessToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	token := &store.PersonalAccessToken{
+		UserID: user.Id,
+		Name:   payload.Name,
+		Token:  auth.HashToken(plainToken),
+		Scopes: payload.Scopes,
+		Expiry: payload.ExpiresAt,
+	}
+
+	if err := app.store.PersonalAccessTokens.Create(r.Context(), token); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponce(w, r, fmt.Errorf("a token named %q already exists", payload.Name))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	response := PersonalAccessTokenWithToken{
+		PersonalAccessToken: token,
+		Token:               plainToken,
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) listPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	tokens, err := app.store.PersonalAccessTokens.GetByUserID(r.Context(), user.Id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) revokePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "tokenId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.PersonalAccessTokens.Delete(r.Context(), user.Id, id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/satyamkale27/Go-social.git/internal/store"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type DeletePayload struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// readDeleteReason reads the optional {"reason": ...} body of a delete request. The reason is
+// required when the user removes something they do not own.
+func (app *application) readDeleteReason(w http.ResponseWriter, r *http.Request, own bool) (string, error) {
+	var payload DeletePayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if err := Validate.Struct(payload); err != nil {
+		return "", err
+	}
+	if !own && payload.Reason == "" {
+		return "", fmt.Errorf("a reason is required to delete content of another user")
+	}
+	return payload.Reason, nil
+}
+
+// getPostTrashHandler lists the user's deleted posts. Those with a deleted_by other than the user
+// were removed by an admin and cannot be restored.
+func (app *application) getPostTrashHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := app.trashQuery(w, r)
+	if !ok {
+		return
+	}
+
+	posts, err := app.store.Posts.GetTrash(r.Context(), getUserFromContext(r).Id, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	since := time.Now().Add(-app.config.cleanup.trashRetention)
+	if err := app.store.Posts.Restore(r.Context(), getUserFromContext(r).Id, id, since); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getCommentTrashHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := app.trashQuery(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := app.store.Comments.GetTrash(r.Context(), getUserFromContext(r).Id, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comments); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	since := time.Now().Add(-app.config.cleanup.trashRetention)
+	if err := app.store.Comments.Restore(r.Context(), getUserFromContext(r).Id, id, since); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) trashQuery(w http.ResponseWriter, r *http.Request) (store.PaginatedQuery, bool) {
+	q, err := store.PaginatedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return q, false
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return q, false
+	}
+	return q, true
+}
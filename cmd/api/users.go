@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/satyamkale27/Go-social.git/internal/auth"
+	"github.com/satyamkale27/Go-social.git/internal/mailer"
 	"github.com/satyamkale27/Go-social.git/internal/store"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type userKey string
@@ -92,6 +98,84 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// resendActivationHandler mails a new activation link and invalidates the previous one. Like the
+// password reset it answers 202 whether or not the email belongs to an account waiting for activation.
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	email := strings.ToLower(payload.Email)
+	limit := app.config.mail.resend
+
+	lockedUntil, err := app.store.LoginAttempts.LockedUntil(ctx, store.LoginScopeActivationResend, email)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+		app.rateLimitExceededResponse(w, r, strconv.Itoa(retryAfter))
+		return
+	}
+	if err := app.store.LoginAttempts.RegisterFailure(ctx, store.LoginScopeActivationResend, email, limit.maxPerEmail, limit.window, limit.window); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	user, err := app.store.Users.RotateInvitation(ctx, payload.Email, auth.HashToken(plainToken), app.config.mail.exp)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.logger.Infow("activation resend requested for unknown or active account")
+			if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendUrl, plainToken)
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: activationURL,
+	}
+
+	// sent in the background so the response time does not tell whether the account exists
+	go func() {
+		status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+		if err != nil {
+			app.logger.Errorw("error sending activation mail", "error", err)
+			return
+		}
+		app.logger.Infow("Email sent", "status code", status)
+	}()
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userId, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope varchar(16) NOT NULL,
+    key text NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    window_start timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone,
+    PRIMARY KEY (scope, key) -- composite key
+);
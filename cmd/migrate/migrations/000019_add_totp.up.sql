@@ -0,0 +1,26 @@
+ALTER TABLE
+    users
+ADD
+    COLUMN totp_secret text;
+
+ALTER TABLE
+    users
+ADD
+    COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- the last accepted time step, so a code cannot be used twice
+ALTER TABLE
+    users
+ADD
+    COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    code bytea NOT NULL,
+    used_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
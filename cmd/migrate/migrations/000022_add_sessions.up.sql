@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid PRIMARY KEY, -- the family_id of the session's refresh tokens
+    user_id bigint NOT NULL,
+    user_agent text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    expiry timestamp(0) with time zone NOT NULL,
+    last_seen_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    revoked_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
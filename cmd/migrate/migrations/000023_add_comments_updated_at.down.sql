@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_post;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,9 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+-- comments of posts deleted before this constraint existed can never be shown again
+DELETE FROM comments WHERE post_id NOT IN (SELECT id FROM posts);
+
+ALTER TABLE comments
+ADD CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_created_at ON comments (post_id, created_at);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_comments_path;
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+DELETE FROM comments WHERE parent_id IS NOT NULL;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS path,
+DROP COLUMN IF EXISTS depth,
+DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,9 @@
+ALTER TABLE comments
+ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES comments (id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS depth int NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS path bigint[] NOT NULL DEFAULT '{}'; -- ids from the top level comment down to this one
+
+UPDATE comments SET path = ARRAY[id] WHERE path = '{}';
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_path ON comments USING gin (path);
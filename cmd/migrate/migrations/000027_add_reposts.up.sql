@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS reposts (
+    user_id bigint NOT NULL,
+    post_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reposts_post_id ON reposts (post_id);
+
+-- a quote whose original is deleted keeps is_quote and loses quoted_post_id, clients show a tombstone
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS quoted_post_id bigint REFERENCES posts (id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS is_quote boolean NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_posts_quoted_post_id ON posts (quoted_post_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_posts_scheduled;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS published_at,
+DROP COLUMN IF EXISTS publish_at,
+DROP COLUMN IF EXISTS status;
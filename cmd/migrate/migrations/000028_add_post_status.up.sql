@@ -0,0 +1,10 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS status varchar(20) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published')),
+ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone,
+ADD COLUMN IF NOT EXISTS published_at timestamp(0) with time zone;
+
+UPDATE posts SET published_at = created_at WHERE status = 'published' AND published_at IS NULL;
+
+-- the scheduler only ever looks at scheduled posts
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
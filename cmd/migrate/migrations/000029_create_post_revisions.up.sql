@@ -0,0 +1,12 @@
+-- one row per replaced version of a post, the current version stays in posts
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id bigint NOT NULL,
+    version int NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    edited_by bigint,
+    edited_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, version),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (edited_by) REFERENCES users (id) ON DELETE SET NULL
+);
@@ -0,0 +1,14 @@
+-- deleted rows stay in the trash until the purge job removes them, deleted_by and delete_reason
+-- record who removed someone else's post or comment and why
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone,
+ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users (id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS delete_reason text;
+
+ALTER TABLE comments
+ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone,
+ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users (id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS delete_reason text;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
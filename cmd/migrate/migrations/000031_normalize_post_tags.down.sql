@@ -0,0 +1,2 @@
+-- the original spelling of the tags is not kept, there is nothing to revert
+SELECT 1;
@@ -0,0 +1,13 @@
+-- tags are lowercase without a leading # from now on, bring existing posts in line so they
+-- are found by the same tag
+UPDATE posts p
+SET tags = (
+    SELECT COALESCE(array_agg(t.tag ORDER BY t.first), '{}')
+    FROM (
+        SELECT lower(ltrim(trim(raw), '#')) AS tag, MIN(ord) AS first
+        FROM unnest(p.tags) WITH ORDINALITY AS u(raw, ord)
+        WHERE lower(ltrim(trim(raw), '#')) <> ''
+        GROUP BY 1
+    ) t
+)
+WHERE p.tags IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS post_mentions;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS entities;
+ALTER TABLE posts DROP COLUMN IF EXISTS entities;
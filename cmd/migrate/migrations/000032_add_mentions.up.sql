@@ -0,0 +1,15 @@
+-- mentions and hashtags found in the content, with their offsets, so clients can render links.
+-- Existing posts and comments start without entities until they are edited.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS entities jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS entities jsonb NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
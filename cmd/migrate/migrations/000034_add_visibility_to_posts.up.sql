@@ -0,0 +1,3 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS visibility varchar(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'followers', 'private'));
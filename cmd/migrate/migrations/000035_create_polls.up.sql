@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS polls (
+    post_id bigint PRIMARY KEY,
+    multiple boolean NOT NULL DEFAULT false,
+    closes_at timestamp(0) with time zone NOT NULL,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL,
+    position int NOT NULL,
+    text varchar(100) NOT NULL,
+    UNIQUE (post_id, position),
+    FOREIGN KEY (post_id) REFERENCES polls (post_id) ON DELETE CASCADE
+);
+
+-- one row per user who voted, its primary key is what stops a second vote
+CREATE TABLE IF NOT EXISTS poll_voters (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES polls (post_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    option_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    PRIMARY KEY (option_id, user_id),
+    FOREIGN KEY (option_id) REFERENCES poll_options (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
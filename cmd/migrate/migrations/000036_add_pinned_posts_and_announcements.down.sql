@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS announcements;
+
+DROP INDEX IF EXISTS idx_posts_pinned;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS pinned_at;
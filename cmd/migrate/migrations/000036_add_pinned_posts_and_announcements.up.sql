@@ -0,0 +1,16 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS pinned_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_posts_pinned ON posts (user_id, pinned_at) WHERE pinned_at IS NOT NULL;
+
+-- posts moderators put at the top of every feed until expires_at
+CREATE TABLE IF NOT EXISTS announcements (
+    post_id bigint PRIMARY KEY,
+    created_by bigint,
+    expires_at timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcements_expires_at ON announcements (expires_at);
@@ -0,0 +1,5 @@
+ALTER TABLE user_token_revocations
+ADD COLUMN IF NOT EXISTS revoked_before timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+ALTER TABLE user_token_revocations
+DROP COLUMN IF EXISTS generation;
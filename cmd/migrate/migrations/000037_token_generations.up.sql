@@ -0,0 +1,8 @@
+-- "log out everywhere" moves the user to a new token generation instead of storing a time cutoff,
+-- which could not tell apart tokens issued in the same second. Users who already have a cutoff start
+-- at generation 1, so their tokens issued before this migration are signed out once more.
+ALTER TABLE user_token_revocations
+ADD COLUMN IF NOT EXISTS generation bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE user_token_revocations
+DROP COLUMN IF EXISTS revoked_before;
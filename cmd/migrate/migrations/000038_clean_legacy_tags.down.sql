@@ -0,0 +1,2 @@
+-- the dropped tags are not kept, there is nothing to revert
+SELECT 1;
@@ -0,0 +1,19 @@
+-- 000031 only lowercased the tags, posts from before may still have tags NormalizeTag rejects
+-- (spaces or punctuation, more than 30 characters) or more than 10 tags, and every edit of their
+-- tags would fail. Drop the invalid tags and keep the first 10.
+UPDATE posts p
+SET tags = (
+    SELECT COALESCE(array_agg(t.tag ORDER BY t.ord), '{}')
+    FROM (
+        SELECT tag, ord
+        FROM unnest(p.tags) WITH ORDINALITY AS u(tag, ord)
+        WHERE tag ~ '^[[:alnum:]_-]+$' AND char_length(tag) <= 30
+        ORDER BY ord
+        LIMIT 10
+    ) t
+)
+WHERE EXISTS (
+    SELECT 1
+    FROM unnest(p.tags) AS u(tag)
+    WHERE tag !~ '^[[:alnum:]_-]+$' OR char_length(tag) > 30
+) OR cardinality(p.tags) > 10;
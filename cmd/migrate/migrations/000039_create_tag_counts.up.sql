@@ -0,0 +1,14 @@
+-- the number of published public posts per tag, so listing and autocompleting tags does not unnest
+-- the tags of every post. Refreshed in the background by the API.
+CREATE MATERIALIZED VIEW IF NOT EXISTS tag_counts AS
+SELECT t.tag, COUNT(*) AS posts
+FROM posts p, unnest(p.tags) AS t(tag)
+WHERE
+    p.status = 'published' AND
+    p.visibility = 'public' AND
+    p.deleted_at IS NULL
+GROUP BY t.tag;
+
+-- unique so the view can be refreshed concurrently, text_pattern_ops so prefix searches use it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tag_counts_tag ON tag_counts (tag text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_tag_counts_posts ON tag_counts (posts DESC, tag);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_user_id ON comment_mentions (user_id);
+
+-- comments written since 000032 already have their resolved mentions in entities
+INSERT INTO comment_mentions (comment_id, user_id)
+SELECT c.id, u.id
+FROM comments c
+CROSS JOIN LATERAL jsonb_array_elements(c.entities) AS e
+JOIN users u ON u.id = (e ->> 'user_id')::bigint
+WHERE e ->> 'type' = 'mention'
+ON CONFLICT DO NOTHING;
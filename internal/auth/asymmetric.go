@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"sort"
+	"time"
+)
+
+// AsymmetricAuthenticator signs tokens with RS256 or EdDSA. Tokens are signed with the active key and
+// validated with any key that is not retired, so keys can be rotated without logging everybody out.
+type AsymmetricAuthenticator struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+	aud    string
+	iss    string
+	issuer tokenIssuer
+}
+
+func NewAsymmetricAuthenticator(keys []*SigningKey, activeKID, aud, iss string, accessTTL, refreshTTL time.Duration) (*AsymmetricAuthenticator, error) {
+	a := &AsymmetricAuthenticator{
+		keys:   make(map[string]*SigningKey, len(keys)),
+		aud:    aud,
+		iss:    iss,
+		issuer: tokenIssuer{aud: aud, iss: iss, accessTTL: accessTTL, refreshTTL: refreshTTL},
+	}
+	for _, key := range keys {
+		a.keys[key.ID] = key
+	}
+
+	active, ok := a.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeKID)
+	}
+	if active.Private == nil || active.Retired {
+		return nil, fmt.Errorf("active signing key %q must be a private key that is not retired", activeKID)
+	}
+	a.active = active
+	return a, nil
+}
+
+func (a *AsymmetricAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(a.active.Method, claims)
+	token.Header["kid"] = a.active.ID
+	tokenString, err := token.SignedString(a.active.Private)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+func (a *AsymmetricAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok || key.Retired {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Public, nil
+	},
+
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name, jwt.SigningMethodEdDSA.Alg()}),
+	)
+}
+
+func (a *AsymmetricAuthenticator) IssueTokens(userID int64, sessionID string, generation int64) (*TokenPair, error) {
+	return a.issuer.issue(a.GenerateToken, userID, sessionID, generation)
+}
+
+// JWKS returns the public keys other services need to verify our tokens.
+func (a *AsymmetricAuthenticator) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range a.keys {
+		if key.Retired {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
@@ -5,4 +5,10 @@ import "github.com/golang-jwt/jwt/v5"
 type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	IssueTokens(userID int64, sessionID string, generation int64) (*TokenPair, error)
+}
+
+// KeyPublisher is implemented by authenticators whose verification keys can be handed out publicly.
+type KeyPublisher interface {
+	JWKS() JWKS
 }
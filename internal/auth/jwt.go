@@ -3,16 +3,23 @@ package auth
 import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"time"
 )
 
 type JWTAuthenticator struct {
 	secretKey string
 	aud       string
 	iss       string
+	issuer    tokenIssuer
 }
 
-func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
-	return &JWTAuthenticator{secret, aud, iss}
+func NewJWTAuthenticator(secret, aud, iss string, accessTTL, refreshTTL time.Duration) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		secretKey: secret,
+		aud:       aud,
+		iss:       iss,
+		issuer:    tokenIssuer{aud: aud, iss: iss, accessTTL: accessTTL, refreshTTL: refreshTTL},
+	}
 }
 
 func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
@@ -39,3 +46,7 @@ func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 	)
 
 }
+
+func (a *JWTAuthenticator) IssueTokens(userID int64, sessionID string, generation int64) (*TokenPair, error) {
+	return a.issuer.issue(a.GenerateToken, userID, sessionID, generation)
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Values of the "typ" claim. Only access tokens are accepted by the API, an mfa_pending token can
+// only be exchanged for a token pair together with a second factor.
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeMFAPending = "mfa_pending"
+)
+
+// TokenPair is what a client receives after logging in or refreshing: a short-lived access token (JWT)
+// and an opaque refresh token that can be exchanged exactly once for a new pair.
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	RefreshTokenHash      string    `json:"-"` // only the hash is persisted
+}
+
+// HashToken returns the hex encoded sha256 of an opaque token, the same way invitation tokens are stored.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type tokenIssuer struct {
+	aud        string
+	iss        string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func (i tokenIssuer) issue(generate func(jwt.Claims) (string, error), userID int64, sessionID string, generation int64) (*TokenPair, error) {
+	now := time.Now()
+	accessExp := now.Add(i.accessTTL)
+
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"exp": accessExp.Unix(),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"iss": i.iss,
+		"aud": i.aud,
+		"jti": uuid.New().String(), // lets a single token be revoked before it expires
+		"typ": TokenTypeAccess,
+		"sid": sessionID,  // the login (device) the token belongs to
+		"gen": generation, // token generation of the user, "log out everywhere" moves to the next one
+	}
+
+	accessToken, err := generate(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExp,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: now.Add(i.refreshTTL),
+		RefreshTokenHash:      HashToken(refreshToken),
+	}, nil
+}
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told apart from JWTs
+// (and found by secret scanners).
+const PersonalAccessTokenPrefix = "gsp_"
+
+func GeneratePersonalAccessToken() (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
@@ -0,0 +1,99 @@
+// Package entities finds @mentions and #hashtags in the text of posts and comments.
+package entities
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	Mention = "mention"
+	Hashtag = "hashtag"
+)
+
+// Entity is a linkable part of a text. Start and End are offsets in characters (Unicode code
+// points), End being exclusive, and cover the leading @ or #.
+type Entity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Text   string `json:"text"`              // the username or tag, without @ or #
+	UserID int64  `json:"user_id,omitempty"` // the mentioned user, set once the mention is resolved
+}
+
+// Parse returns the mentions and hashtags of text in the order they appear. A mention or hashtag
+// has to start the text or follow a character that cannot be part of a word, so e-mail addresses
+// and URL fragments are not picked up.
+func Parse(text string) []Entity {
+	runes := []rune(text)
+	found := []Entity{}
+
+	for i := 0; i < len(runes); i++ {
+		var kind string
+		var allowed func(rune) bool
+		switch runes[i] {
+		case '@':
+			kind, allowed = Mention, isUsernameRune
+		case '#':
+			kind, allowed = Hashtag, isTagRune
+		default:
+			continue
+		}
+		if i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == '@' || runes[i-1] == '#') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && allowed(runes[end]) {
+			end++
+		}
+		// punctuation ending a sentence is not part of the name
+		for end > i+1 && strings.ContainsRune(".-", runes[end-1]) {
+			end--
+		}
+		if end == i+1 {
+			continue
+		}
+
+		found = append(found, Entity{Type: kind, Start: i, End: end, Text: string(runes[i+1 : end])})
+		i = end - 1
+	}
+	return found
+}
+
+// Mentions returns the distinct usernames mentioned in the entities.
+func Mentions(found []Entity) []string {
+	var usernames []string
+	for _, e := range found {
+		if e.Type == Mention && !slices.Contains(usernames, e.Text) {
+			usernames = append(usernames, e.Text)
+		}
+	}
+	return usernames
+}
+
+// Hashtags returns the hashtags of the entities as written, in order of appearance.
+func Hashtags(found []Entity) []string {
+	var tags []string
+	for _, e := range found {
+		if e.Type == Hashtag {
+			tags = append(tags, e.Text)
+		}
+	}
+	return tags
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isUsernameRune matches the characters usernames are made of, see usernameDisallowed in cmd/api.
+func isUsernameRune(r rune) bool {
+	return r < unicode.MaxASCII && (isWordRune(r) || r == '.' || r == '-')
+}
+
+// isTagRune matches the characters store.NormalizeTag accepts.
+func isTagRune(r rune) bool {
+	return isWordRune(r) || r == '-'
+}
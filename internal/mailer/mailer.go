@@ -3,9 +3,10 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "Gosocial"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName              = "Gosocial"
+	maxRetries            = 3
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
 )
 
 /*
@@ -0,0 +1,96 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits of an animated GIF. Every frame decodes to a full paletted image, one byte per pixel, so a
+// few MB of well compressed frames can otherwise take gigabytes of memory.
+const (
+	MaxGIFFrames = 500
+	MaxGIFPixels = 2 * MaxPixels // summed over all frames
+)
+
+var errTruncatedGIF = errors.New("truncated gif")
+
+// checkGIF walks the blocks of a GIF without decoding any pixels. It rejects files with too many
+// frames, too many pixels in total, or a frame that does not fit in the logical screen.
+func checkGIF(data []byte) error {
+	if len(data) < 13 {
+		return errTruncatedGIF
+	}
+	width, height := int(le16(data[6:])), int(le16(data[8:]))
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1) // global color table
+	}
+
+	var frames int
+	var pixels int64
+	for {
+		if pos >= len(data) {
+			return errTruncatedGIF
+		}
+		switch data[pos] {
+		case 0x21: // extension: label and data sub-blocks
+			next, err := skipSubBlocks(data, pos+2)
+			if err != nil {
+				return err
+			}
+			pos = next
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return errTruncatedGIF
+			}
+			left, top := int(le16(data[pos+1:])), int(le16(data[pos+3:]))
+			w, h := int(le16(data[pos+5:])), int(le16(data[pos+7:]))
+			flags := data[pos+9]
+			if left+w > width || top+h > height {
+				return fmt.Errorf("gif frame %dx%d at %d,%d is outside the %dx%d image", w, h, left, top, width, height)
+			}
+
+			frames++
+			pixels += int64(w) * int64(h)
+			if frames > MaxGIFFrames {
+				return fmt.Errorf("gif has more than %d frames", MaxGIFFrames)
+			}
+			if pixels > MaxGIFPixels {
+				return fmt.Errorf("gif frames have more than %d pixels in total", MaxGIFPixels)
+			}
+
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1) // local color table
+			}
+			next, err := skipSubBlocks(data, pos+1) // after the LZW minimum code size
+			if err != nil {
+				return err
+			}
+			pos = next
+		case 0x3B: // trailer
+			return nil
+		default:
+			return fmt.Errorf("gif has an unknown block 0x%02x", data[pos])
+		}
+	}
+}
+
+// skipSubBlocks returns the position after the sub-blocks starting at pos and their terminator.
+func skipSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errTruncatedGIF
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+func le16(b []byte) uint16 {
+	return uint16(b[0]) | uint16(b[1])<<8
+}
@@ -0,0 +1,61 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+func encodeGIF(t *testing.T, frames, size int) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, size, size), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessGIF(t *testing.T) {
+	file, err := Process(encodeGIF(t, 3, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ContentType != "image/gif" || file.Width != 16 || file.Height != 16 {
+		t.Errorf("got %s %dx%d", file.ContentType, file.Width, file.Height)
+	}
+}
+
+func TestProcessGIFTooManyFrames(t *testing.T) {
+	_, err := Process(encodeGIF(t, MaxGIFFrames+1, 1))
+	if err == nil || !strings.Contains(err.Error(), "frames") {
+		t.Fatalf("expected the frame limit, got %v", err)
+	}
+}
+
+func TestProcessGIFTooManyPixels(t *testing.T) {
+	// each frame is within MaxPixels, all of them together are not
+	_, err := Process(encodeGIF(t, 3, 5000))
+	if err == nil || !strings.Contains(err.Error(), "pixels") {
+		t.Fatalf("expected the pixel budget, got %v", err)
+	}
+}
+
+func TestCheckGIFFrameOutsideScreen(t *testing.T) {
+	data := encodeGIF(t, 1, 8)
+	// shrink the logical screen below the frame
+	data[6], data[8] = 4, 4
+	if err := checkGIF(data); err == nil {
+		t.Fatal("expected an error for a frame outside the logical screen")
+	}
+}
@@ -0,0 +1,105 @@
+// Package media checks uploaded files and strips metadata from images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+)
+
+var ErrUnsupportedType = errors.New("unsupported file type")
+
+// MaxPixels bounds the decoded size of an image, a small file can claim huge dimensions.
+const MaxPixels = 25_000_000
+
+// File is an upload that is safe to store and serve.
+type File struct {
+	Data        []byte
+	ContentType string
+	Width       int // zero for files that are not images
+	Height      int
+}
+
+// allowedTypes are the content types accepted for attachments, detected from the content and
+// never taken from the file name or the client's Content-Type.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// Process sniffs the type of data and re-encodes images, which drops EXIF and any other metadata
+// such as GPS positions. JPEG orientation is applied to the pixels before it is lost.
+func Process(data []byte) (*File, error) {
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if !allowedTypes[contentType] {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return processImage(data, contentType)
+	case "text/plain":
+		contentType = "text/plain; charset=utf-8"
+	}
+	return &File{Data: data, ContentType: contentType}, nil
+}
+
+func processImage(data []byte, contentType string) (*File, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: broken image: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+
+	var buf bytes.Buffer
+	file := &File{ContentType: contentType}
+
+	switch contentType {
+	case "image/gif":
+		// decoded frame by frame to keep animations, once the frames are known to fit the budget
+		if err := checkGIF(data); err != nil {
+			return nil, err
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: broken image: %v", ErrUnsupportedType, err)
+		}
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return nil, err
+		}
+		file.Width, file.Height = g.Config.Width, g.Config.Height
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: broken image: %v", ErrUnsupportedType, err)
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		file.Width, file.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: broken image: %v", ErrUnsupportedType, err)
+		}
+		img = orient(img, jpegOrientation(data))
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		file.Width, file.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	file.Data = buf.Bytes()
+	return file, nil
+}
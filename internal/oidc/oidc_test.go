@@ -0,0 +1,245 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is a stand-in OpenID Connect provider serving discovery, its key set and a token
+// endpoint that checks the PKCE verifier against the challenge sent to the authorization endpoint.
+type fakeIssuer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	codes  map[string]authorization
+	claims func(*jwt.MapClaims) // changes the ID token before it is signed
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeIssuer{key: key, clientID: "client", codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		auth, ok := f.codes[r.PostForm.Get("code")]
+		delete(f.codes, r.PostForm.Get("code"))
+		f.mu.Unlock()
+
+		if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != f.clientID {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if CodeChallenge(r.PostForm.Get("code_verifier")) != auth.challenge {
+			http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken(t, auth.nonce)})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorize does what the provider does when the user logs in: it remembers the challenge and nonce
+// of the authorization URL and returns the code the browser is redirected back with.
+func (f *fakeIssuer) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != f.clientID {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	code, err = RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.codes[code] = authorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	f.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (f *fakeIssuer) idToken(t *testing.T, nonce string) string {
+	claims := jwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            "subject-1",
+		"aud":            f.clientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+	if f.claims != nil {
+		f.claims(&claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		t.Error(err)
+	}
+	return signed
+}
+
+func (f *fakeIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Name:        "fake",
+		Issuer:      f.URL,
+		ClientID:    f.clientID,
+		RedirectURL: "http://localhost/callback",
+	})
+}
+
+// login runs the authorization code flow against the stand-in and returns the result of Exchange.
+func login(t *testing.T, f *fakeIssuer, verifierAtCallback func(string) string) (*Claims, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	p := f.provider()
+
+	verifier, _ := RandomString()
+	nonce, _ := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := f.authorize(t, authURL)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+	if verifierAtCallback != nil {
+		verifier = verifierAtCallback(verifier)
+	}
+	return p.Exchange(ctx, code, verifier, nonce)
+}
+
+func TestLogin(t *testing.T) {
+	f := newFakeIssuer(t)
+
+	claims, err := login(t, f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestLoginWrongVerifier(t *testing.T) {
+	f := newFakeIssuer(t)
+
+	_, err := login(t, f, func(string) string { return "another verifier" })
+	if err == nil {
+		t.Fatal("expected the token endpoint to refuse the code")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims func(*jwt.MapClaims)
+	}{
+		{"nonce mismatch", func(c *jwt.MapClaims) { (*c)["nonce"] = "replayed" }},
+		{"missing nonce", func(c *jwt.MapClaims) { delete(*c, "nonce") }},
+		{"wrong audience", func(c *jwt.MapClaims) { (*c)["aud"] = "another-client" }},
+		{"wrong issuer", func(c *jwt.MapClaims) { (*c)["iss"] = "https://evil.example.com" }},
+		{"expired", func(c *jwt.MapClaims) { (*c)["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"missing subject", func(c *jwt.MapClaims) { delete(*c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeIssuer(t)
+			f.claims = tt.claims
+
+			_, err := login(t, f, nil)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	t.Run("foreign key", func(t *testing.T) {
+		f := newFakeIssuer(t)
+		p := f.provider()
+
+		f.key = other // the key set still publishes the original key
+		raw := f.idToken(t, "n")
+
+		if _, err := p.VerifyIDToken(context.Background(), raw, "n"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("err = %v, want ErrInvalidIDToken", err)
+		}
+	})
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := NewProvider(Config{Issuer: f.URL + "/", ClientID: f.clientID})
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("expected an error for an issuer that differs from the discovery document")
+	}
+}
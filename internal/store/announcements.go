@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Announcement puts a post at the top of every feed until ExpiresAt.
+type Announcement struct {
+	PostID    int64     `json:"post_id"`
+	CreatedBy int64     `json:"created_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt string    `json:"created_at"`
+}
+
+type AnnouncementStore struct {
+	db *sql.DB
+}
+
+// Set announces the post, or moves the expiry of an existing announcement. Only published public
+// posts can be announced, ErrNotFound is returned for any other.
+func (s *AnnouncementStore) Set(ctx context.Context, a *Announcement) error {
+	query := `
+INSERT INTO announcements (post_id, created_by, expires_at)
+SELECT id, $2, $3 FROM posts WHERE id = $1 AND status = 'published' AND visibility = 'public' AND deleted_at IS NULL
+ON CONFLICT (post_id) DO UPDATE SET created_by = EXCLUDED.created_by, expires_at = EXCLUDED.expires_at
+RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, a.PostID, a.CreatedBy, a.ExpiresAt).Scan(&a.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AnnouncementStore) Delete(ctx context.Context, postID int64) error {
+	query := `DELETE FROM announcements WHERE post_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes announcements that are no longer shown.
+func (s *AnnouncementStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM announcements WHERE expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
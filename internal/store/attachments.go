@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+var ErrTooManyAttachments = errors.New("too many attachments")
+
+// Attachment is a file uploaded to a post. The file itself lives in blob storage under Key and is
+// only reachable through a signed URL, set on the attachment before it is returned to a client.
+type Attachment struct {
+	ID           int64      `json:"id"`
+	PostID       int64      `json:"post_id"`
+	UserID       int64      `json:"user_id"`
+	Key          string     `json:"-"`
+	Filename     string     `json:"filename"`
+	ContentType  string     `json:"content_type"`
+	Size         int64      `json:"size"`
+	Width        *int       `json:"width,omitempty"` // images only
+	Height       *int       `json:"height,omitempty"`
+	CreatedAt    string     `json:"created_at"`
+	URL          string     `json:"url"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+type AttachmentStore struct {
+	db *sql.DB
+}
+
+// Create records an upload unless the post already has maxPerPost attachments, in which case
+// ErrTooManyAttachments is returned.
+func (s *AttachmentStore) Create(ctx context.Context, a *Attachment, maxPerPost int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// the post row lock serializes concurrent uploads to the same post
+		var count int
+		err := tx.QueryRowContext(ctx, `
+SELECT (SELECT COUNT(*) FROM attachments WHERE post_id = p.id)
+FROM posts p WHERE p.id = $1 AND p.deleted_at IS NULL
+FOR UPDATE`, a.PostID).Scan(&count)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if count >= maxPerPost {
+			return ErrTooManyAttachments
+		}
+
+		query := `
+INSERT INTO attachments (post_id, user_id, storage_key, filename, content_type, size, width, height)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, created_at`
+
+		return tx.QueryRowContext(ctx, query, a.PostID, a.UserID, a.Key, a.Filename, a.ContentType, a.Size, a.Width, a.Height).Scan(
+			&a.ID, &a.CreatedAt,
+		)
+	})
+}
+
+// GetById returns the attachment as long as its post is not deleted.
+func (s *AttachmentStore) GetById(ctx context.Context, id int64) (*Attachment, error) {
+	query := `
+SELECT a.id, a.post_id, a.user_id, a.storage_key, a.filename, a.content_type, a.size, a.width, a.height, a.created_at
+FROM attachments a
+JOIN posts p ON p.id = a.post_id
+WHERE a.id = $1 AND p.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var a Attachment
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&a.ID, &a.PostID, &a.UserID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &a, nil
+}
+
+// GetByPostIDs loads the attachments of several posts at once, in upload order, keyed by post id.
+func (s *AttachmentStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Attachment, error) {
+	query := `
+SELECT id, post_id, user_id, storage_key, filename, content_type, size, width, height, created_at
+FROM attachments
+WHERE post_id = ANY($1)
+ORDER BY post_id, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := map[int64][]Attachment{}
+	for rows.Next() {
+		var a Attachment
+		err := rows.Scan(&a.ID, &a.PostID, &a.UserID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachments[a.PostID] = append(attachments[a.PostID], a)
+	}
+	return attachments, rows.Err()
+}
+
+// Delete removes the attachment of the post and returns it, so the caller can delete the blob.
+func (s *AttachmentStore) Delete(ctx context.Context, postID, id int64) (*Attachment, error) {
+	query := `
+DELETE FROM attachments WHERE id = $1 AND post_id = $2
+RETURNING id, post_id, user_id, storage_key, filename, content_type, size, width, height, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var a Attachment
+	err := s.db.QueryRowContext(ctx, query, id, postID).Scan(
+		&a.ID, &a.PostID, &a.UserID, &a.Key, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &a, nil
+}
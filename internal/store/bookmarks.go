@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Collection is a named list of posts a user saved for later.
+type Collection struct {
+	Id        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	PostCount int64     `json:"post_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SavedPost struct {
+	Post
+	SavedAt time.Time `json:"saved_at"`
+}
+
+type BookmarkStore struct {
+	db *sql.DB
+}
+
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *Collection) error {
+	query := `INSERT INTO collections (user_id, name) VALUES ($1, $2) RETURNING id, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(
+		&collection.Id, &collection.CreatedAt, &collection.UpdatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *BookmarkStore) GetCollections(ctx context.Context, userId int64) ([]Collection, error) {
+	query := `
+SELECT c.id, c.user_id, c.name, COUNT(p.id), c.created_at, c.updated_at
+FROM collections c
+LEFT JOIN collection_items ci ON ci.collection_id = c.id
+LEFT JOIN posts p ON p.id = ci.post_id AND p.status = 'published' AND p.deleted_at IS NULL AND ` + visibleTo("p", "c.user_id") + `
+WHERE c.user_id = $1
+GROUP BY c.id
+ORDER BY c.name
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.Id, &c.UserID, &c.Name, &c.PostCount, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// GetCollection returns the collection only if it belongs to the user.
+func (s *BookmarkStore) GetCollection(ctx context.Context, userId, id int64) (*Collection, error) {
+	query := `
+SELECT c.id, c.user_id, c.name, (
+    SELECT COUNT(*) FROM collection_items ci JOIN posts p ON p.id = ci.post_id
+    WHERE ci.collection_id = c.id AND p.status = 'published' AND p.deleted_at IS NULL AND ` + visibleTo("p", "c.user_id") + `
+), c.created_at, c.updated_at
+FROM collections c
+WHERE c.id = $1 AND c.user_id = $2
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var c Collection
+	err := s.db.QueryRowContext(ctx, query, id, userId).Scan(&c.Id, &c.UserID, &c.Name, &c.PostCount, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+func (s *BookmarkStore) RenameCollection(ctx context.Context, collection *Collection) error {
+	query := `UPDATE collections SET name = $1, updated_at = NOW() WHERE id = $2 AND user_id = $3 RETURNING updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.Name, collection.Id, collection.UserID).Scan(&collection.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, userId, id int64) error {
+	query := `DELETE FROM collections WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddPost saves the post into the collection, saving it twice is a no-op. It returns ErrNotFound
+// when the post does not exist, is not published, is in the trash or the owner of the collection
+// may not see it.
+func (s *BookmarkStore) AddPost(ctx context.Context, collectionId, postId int64) error {
+	query := `
+WITH post AS (
+    SELECT p.id FROM posts p JOIN collections c ON c.id = $1
+    WHERE p.id = $2 AND p.status = 'published' AND p.deleted_at IS NULL AND ` + visibleTo("p", "c.user_id") + `
+), saved AS (
+    INSERT INTO collection_items (collection_id, post_id) SELECT $1, id FROM post ON CONFLICT DO NOTHING
+)
+SELECT EXISTS (SELECT 1 FROM post)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var found bool
+	err := s.db.QueryRowContext(ctx, query, collectionId, postId).Scan(&found)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *BookmarkStore) RemovePost(ctx context.Context, collectionId, postId int64) error {
+	query := `DELETE FROM collection_items WHERE collection_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collectionId, postId)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetPosts returns a page of the saved posts, ordered by when they were saved and filtered like the feed.
+// Posts the owner of the collection can no longer see are left out.
+func (s *BookmarkStore) GetPosts(ctx context.Context, collectionId int64, fq PaginatedFeedQuery) ([]SavedPost, error) {
+	query := `
+SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.visibility, p.tags, p.entities, u.username, ci.created_at
+FROM collection_items ci
+JOIN collections c ON c.id = ci.collection_id
+JOIN posts p ON p.id = ci.post_id
+LEFT JOIN users u ON u.id = p.user_id
+WHERE
+    ci.collection_id = $1 AND
+    p.status = 'published' AND
+    p.deleted_at IS NULL AND
+    ` + visibleTo("p", "c.user_id") + ` AND
+    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%' ) AND
+    (p.tags @> $5 OR $5 = '{}'  )
+ORDER BY ci.created_at ` + fq.Sort + `
+LIMIT $2 OFFSET $3
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, collectionId, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []SavedPost{}
+	for rows.Next() {
+		var p SavedPost
+		err := rows.Scan(
+			&p.Id, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.Version, &p.Visibility, pq.Array(&p.Tags), &p.Entities,
+			&p.User.Username, &p.SavedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
@@ -3,35 +3,88 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"github.com/lib/pq"
 	"time"
 )
 
 type Comment struct {
-	ID        int64     `json:"id"`
-	PostID    int64     `json:"post_id"`
-	UserID    int64     `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	User      User      `json:"user"` // User is a struct
-
+	ID           int64      `json:"id"`
+	PostID       int64      `json:"post_id"`
+	UserID       int64      `json:"user_id"`
+	ParentID     *int64     `json:"parent_id"`
+	Depth        int        `json:"depth"`
+	Path         []int64    `json:"path"` // ids from the top level comment down to this one
+	Content      string     `json:"content"`
+	Entities     Entities   `json:"entities"` // mentions and hashtags in Content
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ReplyCount   int64      `json:"reply_count"`          // direct replies
+	TotalReplies int64      `json:"total_replies"`        // replies at any depth below this comment
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"` // only set for comments in the trash
+	DeletedBy    *int64     `json:"deleted_by,omitempty"`
+	DeleteReason string     `json:"delete_reason,omitempty"`
+	User         User       `json:"user"` // User is a struct
+	Replies      []*Comment `json:"replies,omitempty"`
 }
 
 type comentStore struct {
 	db *sql.DB
 }
 
-func (s *comentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// GetPageByPostID returns one page of comments of a post, or of replies to q.ParentID, ordered depth first:
+// every comment is followed by up to q.Replies of its replies and, below each of those, up to q.Replies
+// of theirs. Deeper replies and the rest of a thread are loaded page by page with ParentID set, so a
+// large thread is never read in one query.
+// Deleted comments are left out together with the replies below them.
+func (s *comentStore) GetPageByPostID(ctx context.Context, postID int64, q CommentQuery) ([]Comment, error) {
 	query := `
-               SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id  FROM comments c
-              JOIN users ON users.id = c.user_id
-              WHERE c.post_id= $1
-              ORDER BY c.created_at DESC;
+WITH page AS (
+    SELECT c.id, ROW_NUMBER() OVER (ORDER BY c.created_at ` + q.Sort + `, c.id ` + q.Sort + `) AS rank
+    FROM comments c
+    WHERE c.post_id = $1 AND c.parent_id IS NOT DISTINCT FROM $2 AND c.deleted_at IS NULL
+    ORDER BY c.created_at ` + q.Sort + `, c.id ` + q.Sort + `
+    LIMIT $3 OFFSET $4
+), replies AS (
+    SELECT id FROM (
+        SELECT c.id, ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.created_at, c.id) AS rn
+        FROM comments c
+        WHERE c.parent_id IN (SELECT id FROM page) AND c.deleted_at IS NULL
+    ) ranked
+    WHERE rn <= $5
+), nested_replies AS (
+    SELECT id FROM (
+        SELECT c.id, ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.created_at, c.id) AS rn
+        FROM comments c
+        WHERE c.parent_id IN (SELECT id FROM replies) AND c.deleted_at IS NULL
+    ) ranked
+    WHERE rn <= $5
+), selected AS (
+    SELECT id FROM page
+    UNION ALL SELECT id FROM replies
+    UNION ALL SELECT id FROM nested_replies
+)
+SELECT
+    c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.path, c.content, c.entities, c.created_at, c.updated_at,
+    u.username, u.id,
+    (SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL) AS reply_count,
+    (
+        SELECT COUNT(*) FROM comments d
+        WHERE d.path @> ARRAY[c.id] AND d.id <> c.id AND NOT EXISTS (
+            SELECT 1 FROM comments a WHERE a.id = ANY (d.path) AND a.deleted_at IS NOT NULL
+        )
+    ) AS total_replies
+FROM comments c
+JOIN selected s ON s.id = c.id
+JOIN users u ON u.id = c.user_id
+JOIN page p ON p.id = c.path[COALESCE((SELECT depth FROM comments WHERE id = $2), -1) + 2]
+ORDER BY p.rank, c.path
 `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, q.ParentID, q.Limit, q.Offset, q.Replies)
 	if err != nil {
 		return nil, err
 	}
@@ -39,13 +92,10 @@ func (s *comentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment,
 	comments := []Comment{}
 	for rows.Next() {
 		var c Comment
-		c.User = User{}
-		/*
-			 c.User = User{}
-			This explicitly initializes the User field of the Comment struct to an empty User struct.
-		*/
-
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, c.User.Username, c.User.Id)
+		err := rows.Scan(
+			&c.ID, &c.PostID, &c.UserID, &c.ParentID, &c.Depth, pq.Array(&c.Path), &c.Content, &c.Entities, &c.CreatedAt, &c.UpdatedAt,
+			&c.User.Username, &c.User.Id, &c.ReplyCount, &c.TotalReplies,
+		)
 		if err != nil {
 			return nil, err
 		}
@@ -56,7 +106,7 @@ func (s *comentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment,
 			with the elements added.
 		*/
 	}
-	return comments, nil
+	return comments, rows.Err()
 }
 
 /*
@@ -66,14 +116,226 @@ allowing you to store and manage a collection of comments in a single variable.
 Each element in the slice is of type Comment.
 */
 
+// CommentTree nests comments returned by GetPageByPostID under their parents. Comments whose parent
+// is not in the list are returned at the top.
+func CommentTree(comments []Comment) []*Comment {
+	nodes := make(map[int64]*Comment, len(comments))
+	tree := []*Comment{}
+	for i := range comments {
+		c := &comments[i]
+		nodes[c.ID] = c
+		if c.ParentID != nil {
+			if parent, ok := nodes[*c.ParentID]; ok {
+				parent.Replies = append(parent.Replies, c)
+				continue
+			}
+		}
+		tree = append(tree, c)
+	}
+	return tree
+}
+
+func (s *comentStore) GetById(ctx context.Context, commentID int64) (*Comment, error) {
+	query := `
+SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.path, c.content, c.entities, c.created_at, c.updated_at,
+    u.username, u.id
+FROM comments c
+JOIN users u ON u.id = c.user_id
+WHERE c.id = $1 AND NOT EXISTS (
+    SELECT 1 FROM comments a WHERE a.id = ANY (c.path) AND a.deleted_at IS NOT NULL
+)
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var c Comment
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&c.ID, &c.PostID, &c.UserID, &c.ParentID, &c.Depth, pq.Array(&c.Path), &c.Content, &c.Entities, &c.CreatedAt, &c.UpdatedAt,
+		&c.User.Username, &c.User.Id,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// Create stores a comment, or a reply when ParentID is set. A reply's parent has to be on the same post
+// and not deleted, otherwise ErrNotFound is returned. Mentions and hashtags in the content are kept
+// as entities and mentioned users are recorded.
 func (s *comentStore) Create(ctx context.Context, comment *Comment) error {
-	query := `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id,created_at`
+	query := `
+WITH n AS (SELECT nextval(pg_get_serial_sequence('comments', 'id')) AS id)
+INSERT INTO comments (id, post_id, user_id, content, entities, path)
+SELECT n.id, $1, $2, $3, $4, ARRAY[n.id] FROM n
+RETURNING id, depth, path, created_at, updated_at
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	found, mentioned, err := parseEntities(ctx, s.db, comment.Content)
+	if err != nil {
+		return err
+	}
+	comment.Entities = found
+
+	args := []any{comment.PostID, comment.UserID, comment.Content, comment.Entities}
+
+	if comment.ParentID != nil {
+		query = `
+WITH n AS (SELECT nextval(pg_get_serial_sequence('comments', 'id')) AS id)
+INSERT INTO comments (id, post_id, user_id, content, entities, parent_id, depth, path)
+SELECT n.id, $1, $2, $3, $4, p.id, p.depth + 1, p.path || n.id
+FROM n, comments p
+WHERE p.id = $5 AND p.post_id = $1 AND NOT EXISTS (
+    SELECT 1 FROM comments a WHERE a.id = ANY (p.path) AND a.deleted_at IS NOT NULL
+)
+RETURNING id, depth, path, created_at, updated_at
+`
+		args = append(args, *comment.ParentID)
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(
+			&comment.ID, &comment.Depth, pq.Array(&comment.Path), &comment.CreatedAt, &comment.UpdatedAt,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return setCommentMentions(ctx, tx, comment.ID, mentioned)
+	})
+}
+
+func (s *comentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `UPDATE comments SET content = $1, entities = $3, updated_at = NOW() WHERE id = $2 RETURNING updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	found, mentioned, err := parseEntities(ctx, s.db, comment.Content)
+	if err != nil {
+		return err
+	}
+	comment.Entities = found
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, comment.Content, comment.ID, comment.Entities).Scan(&comment.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return setCommentMentions(ctx, tx, comment.ID, mentioned)
+	})
+}
+
+// Delete moves the comment to the trash, the replies below it are hidden with it.
+func (s *comentStore) Delete(ctx context.Context, commentID int64, deletedBy int64, reason string) error {
+	query := `
+UPDATE comments SET deleted_at = NOW(), deleted_by = $2, delete_reason = NULLIF($3, '')
+WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, commentID, deletedBy, reason)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetTrash returns the deleted comments of the user that have not been purged yet, most recently deleted first.
+func (s *comentStore) GetTrash(ctx context.Context, userId int64, q PaginatedQuery) ([]Comment, error) {
+	query := `
+SELECT c.id, c.post_id, c.user_id, c.parent_id, c.depth, c.path, c.content, c.created_at, c.updated_at,
+    c.deleted_at, c.deleted_by, COALESCE(c.delete_reason, '')
+FROM comments c
+WHERE c.user_id = $1 AND c.deleted_at IS NOT NULL
+ORDER BY c.deleted_at ` + q.Sort + `, c.id ` + q.Sort + `
+LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(
+			&c.ID, &c.PostID, &c.UserID, &c.ParentID, &c.Depth, pq.Array(&c.Path), &c.Content, &c.CreatedAt, &c.UpdatedAt,
+			&c.DeletedAt, &c.DeletedBy, &c.DeleteReason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// Restore takes a comment the user deleted themselves out of the trash, as long as it was deleted after since.
+// Comments removed by someone else stay deleted and ErrNotFound is returned.
+func (s *comentStore) Restore(ctx context.Context, userId, commentID int64, since time.Time) error {
+	query := `
+UPDATE comments SET deleted_at = NULL, deleted_by = NULL, delete_reason = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_by = $2 AND deleted_at > $3`
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	res, err := s.db.ExecContext(ctx, query, commentID, userId, since)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
+
+// PurgeDeleted removes comments that were deleted before the given time for good, replies included.
+func (s *comentStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM comments WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/satyamkale27/Go-social.git/internal/entities"
+	"slices"
+)
+
+// Entities are the mentions and hashtags of a post or comment, stored as jsonb next to the content.
+type Entities []entities.Entity
+
+func (e Entities) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *Entities) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("entities: expected jsonb")
+	}
+	return json.Unmarshal(b, e)
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// parseEntities finds the entities of content, keeping only mentions of existing active users and
+// hashtags that are valid tags. It returns them with the ids of the mentioned users.
+func parseEntities(ctx context.Context, db querier, content string) (Entities, []int64, error) {
+	found := entities.Parse(content)
+
+	users := map[string]int64{}
+	if usernames := entities.Mentions(found); len(usernames) > 0 {
+		query := `SELECT id, username FROM users WHERE username = ANY($1) AND is_active = true`
+
+		rows, err := db.QueryContext(ctx, query, pq.Array(usernames))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var username string
+			if err := rows.Scan(&id, &username); err != nil {
+				return nil, nil, err
+			}
+			users[username] = id
+		}
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	resolved := Entities{}
+	userIDs := []int64{}
+	for _, e := range found {
+		switch e.Type {
+		case entities.Mention:
+			id, ok := users[e.Text]
+			if !ok {
+				continue
+			}
+			e.UserID = id
+			if !slices.Contains(userIDs, id) {
+				userIDs = append(userIDs, id)
+			}
+		case entities.Hashtag:
+			tag, err := NormalizeTag(e.Text)
+			if err != nil {
+				continue
+			}
+			e.Text = tag
+		}
+		resolved = append(resolved, e)
+	}
+	return resolved, userIDs, nil
+}
+
+// mergeHashtags adds the hashtags of the entities to the tags of a post, as far as MaxTagsPerPost allows.
+func mergeHashtags(tags []string, found Entities) []string {
+	merged := slices.Clone(tags)
+	for _, e := range found {
+		if len(merged) >= MaxTagsPerPost {
+			break
+		}
+		if e.Type == entities.Hashtag && !slices.Contains(merged, e.Text) {
+			merged = append(merged, e.Text)
+		}
+	}
+	return merged
+}
+
+// addedHashtags drops the hashtags that were already in the previous content of a post, so an edit
+// only adds the tags of new hashtags and a tag removed on purpose is not brought back.
+func addedHashtags(found Entities, previous string) Entities {
+	before := map[string]bool{}
+	for _, e := range entities.Parse(previous) {
+		if tag, err := NormalizeTag(e.Text); err == nil && e.Type == entities.Hashtag {
+			before[tag] = true
+		}
+	}
+
+	var added Entities
+	for _, e := range found {
+		if e.Type == entities.Hashtag && !before[e.Text] {
+			added = append(added, e)
+		}
+	}
+	return added
+}
+
+// setPostMentions makes the users mentioned in a post exactly userIDs.
+func setPostMentions(ctx context.Context, tx *sql.Tx, postID int64, userIDs []int64) error {
+	return setMentions(ctx, tx, "post_mentions", "post_id", postID, userIDs)
+}
+
+// setCommentMentions makes the users mentioned in a comment exactly userIDs.
+func setCommentMentions(ctx context.Context, tx *sql.Tx, commentID int64, userIDs []int64) error {
+	return setMentions(ctx, tx, "comment_mentions", "comment_id", commentID, userIDs)
+}
+
+// setMentions replaces the rows of a mentions table for one post or comment, table and column
+// are constants of the callers.
+func setMentions(ctx context.Context, tx *sql.Tx, table, column string, id int64, userIDs []int64) error {
+	query := `DELETE FROM ` + table + ` WHERE ` + column + ` = $1 AND NOT (user_id = ANY($2))`
+	if _, err := tx.ExecContext(ctx, query, id, pq.Array(userIDs)); err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	query = `
+INSERT INTO ` + table + ` (` + column + `, user_id)
+SELECT $1, unnest($2::bigint[])
+ON CONFLICT DO NOTHING`
+
+	_, err := tx.ExecContext(ctx, query, id, pq.Array(userIDs))
+	return err
+}
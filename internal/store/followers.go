@@ -46,3 +46,18 @@ func (s *FollowerStore) Unfollow(ctx context.Context, followerId, userId int64)
 	}
 	return nil
 }
+
+// IsFollowing tells whether followerId follows userId.
+func (s *FollowerStore) IsFollowing(ctx context.Context, followerId, userId int64) (bool, error) {
+
+	query := `SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var following bool
+	if err := s.db.QueryRowContext(ctx, query, userId, followerId).Scan(&following); err != nil {
+		return false, err
+	}
+	return following, nil
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// UserIdentity links an account to a user at an external OpenID Connect provider.
+type UserIdentity struct {
+	Id        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OIDCLoginState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s *IdentityStore) CreateLoginState(ctx context.Context, state *OIDCLoginState) error {
+	query := `INSERT INTO oidc_login_states (state, nonce, code_verifier, expiry) VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, state.State, state.Nonce, state.CodeVerifier, state.Expiry)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConsumeLoginState returns and deletes the login state, so every state can complete one login only.
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, state string) (*OIDCLoginState, error) {
+	query := `DELETE FROM oidc_login_states WHERE state = $1 RETURNING state, nonce, code_verifier, expiry`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var ls OIDCLoginState
+	err := s.db.QueryRowContext(ctx, query, state).Scan(&ls.State, &ls.Nonce, &ls.CodeVerifier, &ls.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	if ls.Expiry.Before(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &ls, nil
+}
+
+// DeleteExpiredLoginStates removes the states of logins that were abandoned at the provider.
+func (s *IdentityStore) DeleteExpiredLoginStates(ctx context.Context) (int64, error) {
+	query := `DELETE FROM oidc_login_states WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetUserID returns the id of the active user linked to the provider subject.
+func (s *IdentityStore) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	query := `
+SELECT u.id FROM user_identities ui
+JOIN users u ON u.id = ui.user_id
+WHERE ui.provider = $1 AND ui.subject = $2 AND u.is_active = true
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var userId int64
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(&userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userId, nil
+}
+
+func (s *IdentityStore) Link(ctx context.Context, identity *UserIdentity) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.Id, &identity.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateUserWithIdentity registers an already active user (the provider verified the email) together with
+// the identity it logged in with. user.Password must be set, even if nobody knows it.
+func (s *IdentityStore) CreateUserWithIdentity(ctx context.Context, user *User, identity *UserIdentity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+INSERT INTO users (username, password, email, is_active, role_id)
+VALUES ($1, $2, $3, true, (SELECT id FROM roles WHERE name = 'user')) RETURNING id, created_at, is_active
+`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, user.Username, user.Password.hash, user.Email).Scan(&user.Id, &user.CreatedAt, &user.IsActive)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				switch pqErr.Constraint {
+				case "users_email_key":
+					return ErrDuplicateEmail
+				case "users_username_key":
+					return ErrDuplicateUsername
+				}
+			}
+			return err
+		}
+
+		identity.UserID = user.Id
+		query = `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+		err = tx.QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).Scan(&identity.Id, &identity.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+
+	// not logins, but counted the same way to rate limit activation and password reset mails per email
+	LoginScopeActivationResend = "resend"
+	LoginScopePasswordReset    = "reset"
+)
+
+type LoginAttemptStore struct {
+	db *sql.DB
+}
+
+// LockedUntil returns the time until which the key is locked out, or the zero time if it is not locked.
+func (s *LoginAttemptStore) LockedUntil(ctx context.Context, scope, key string) (time.Time, error) {
+	query := `SELECT locked_until FROM login_attempts WHERE scope = $1 AND key = $2 AND locked_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var lockedUntil time.Time
+	err := s.db.QueryRowContext(ctx, query, scope, key).Scan(&lockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, err
+		}
+	}
+	return lockedUntil, nil
+}
+
+// RegisterFailure counts a failed login for the key. Failures older than window start a new count,
+// and reaching maxFailures inside the window locks the key out for lockout.
+func (s *LoginAttemptStore) RegisterFailure(ctx context.Context, scope, key string, maxFailures int, window, lockout time.Duration) error {
+	query := `
+INSERT INTO login_attempts (scope, key, failures, window_start, locked_until)
+VALUES ($1, $2, 1, NOW(), CASE WHEN $3 <= 1 THEN NOW() + make_interval(secs => $5) END)
+ON CONFLICT (scope, key) DO UPDATE SET
+    failures = CASE
+        WHEN login_attempts.window_start < NOW() - make_interval(secs => $4) THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    window_start = CASE
+        WHEN login_attempts.window_start < NOW() - make_interval(secs => $4) THEN NOW()
+        ELSE login_attempts.window_start
+    END,
+    locked_until = CASE
+        WHEN login_attempts.window_start >= NOW() - make_interval(secs => $4) AND login_attempts.failures + 1 >= $3
+            THEN NOW() + make_interval(secs => $5)
+        ELSE login_attempts.locked_until
+    END
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, scope, key, maxFailures, window.Seconds(), lockout.Seconds())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, scope, key string) error {
+	query := `DELETE FROM login_attempts WHERE scope = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, scope, key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
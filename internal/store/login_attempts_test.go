@@ -0,0 +1,39 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestLoginScopesFitColumn makes sure every scope fits login_attempts.scope, a longer one makes
+// every RegisterFailure of that scope fail.
+func TestLoginScopesFitColumn(t *testing.T) {
+	migrations, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	column := regexp.MustCompile(`(?:scope varchar|ALTER COLUMN scope TYPE varchar)\((\d+)\)`)
+	size := 0
+	for _, name := range migrations { // in the order they are applied
+		sql, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range column.FindAllSubmatch(sql, -1) {
+			size, _ = strconv.Atoi(string(m[1]))
+		}
+	}
+	if size == 0 {
+		t.Fatal("login_attempts.scope not found in the migrations")
+	}
+
+	for _, scope := range []string{LoginScopeAccount, LoginScopeIP, LoginScopeActivationResend, LoginScopePasswordReset} {
+		if len(scope) > size {
+			t.Errorf("scope %q is longer than login_attempts.scope, varchar(%d)", scope, size)
+		}
+	}
+}
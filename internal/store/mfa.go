@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFASecretReplaced = errors.New("two-factor enrollment was restarted with a new secret")
+)
+
+type TOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+func (s *MFAStore) GetTOTP(ctx context.Context, userId int64) (*TOTP, error) {
+	query := `SELECT COALESCE(totp_secret, ''), totp_enabled, totp_last_step FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var totp TOTP
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// SetPendingSecret stores a secret that only becomes active once EnableTOTP confirms it.
+func (s *MFAStore) SetPendingSecret(ctx context.Context, userId int64, secret string) error {
+	query := `UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_enabled = false`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, secret, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP turns on the pending secret, which must still be the secret the code was checked
+// against, and replaces the recovery codes with the given hashes. It returns ErrMFASecretReplaced
+// when the enrollment was restarted in the meantime.
+func (s *MFAStore) EnableTOTP(ctx context.Context, userId int64, secret string, step int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET totp_enabled = true, totp_last_step = $1 WHERE id = $2 AND totp_secret = $3 AND totp_enabled = false`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, step, userId, secret)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			var enabled bool
+			if err := tx.QueryRowContext(ctx, `SELECT totp_enabled FROM users WHERE id = $1`, userId).Scan(&enabled); err != nil {
+				return err
+			}
+			if enabled {
+				return ErrMFAAlreadyEnabled
+			}
+			return ErrMFASecretReplaced
+		}
+
+		if err := s.deleteRecoveryCodes(ctx, tx, userId); err != nil {
+			return err
+		}
+		for _, code := range recoveryCodes {
+			query := `INSERT INTO mfa_recovery_codes (user_id, code) VALUES ($1, $2)`
+			if _, err := tx.ExecContext(ctx, query, userId, code); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *MFAStore) DisableTOTP(ctx context.Context, userId int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0 WHERE id = $1`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, userId); err != nil {
+			return err
+		}
+		return s.deleteRecoveryCodes(ctx, tx, userId)
+	})
+}
+
+// UseTOTPStep records step as used. It returns false when this or a later step was already used,
+// which means the code is being replayed.
+func (s *MFAStore) UseTOTPStep(ctx context.Context, userId int64, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, step, userId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// UseRecoveryCode burns the recovery code with the given hash. It returns false if there is no unused one.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userId int64, code string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userId, code)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *MFAStore) deleteRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int64) error {
+	query := `DELETE FROM mfa_recovery_codes WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
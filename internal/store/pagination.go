@@ -51,7 +51,11 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	tags := qs.Get("tags")
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		normalized, err := NormalizeTags(strings.Split(tags, ","))
+		if err != nil {
+			return fq, err
+		}
+		fq.Tags = normalized
 	}
 
 	search := qs.Get("search")
@@ -71,6 +75,65 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	return fq, nil
 }
 
+// PaginatedQuery pages through a list ordered by creation time.
+type PaginatedQuery struct {
+	Limit  int    `json:"limit" validate:"min=1,max=50"`
+	Offset int    `json:"offset" validate:"min=0"`
+	Sort   string `json:"sort" validate:"oneof=asc desc"`
+}
+
+func (q PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+		q.Offset = o
+	}
+
+	if sort := qs.Get("sort"); sort != "" {
+		q.Sort = sort
+	}
+
+	return q, nil
+}
+
+// CommentQuery pages through the top level comments of a post, or through the replies of ParentID,
+// loading up to Replies replies under each comment, two levels deep.
+type CommentQuery struct {
+	PaginatedQuery
+	ParentID *int64 `json:"parent_id"`
+	Replies  int    `json:"replies" validate:"min=0,max=10"`
+}
+
+func (q CommentQuery) Parse(r *http.Request) (CommentQuery, error) {
+	page, err := q.PaginatedQuery.Parse(r)
+	if err != nil {
+		return q, err
+	}
+	q.PaginatedQuery = page
+
+	if replies := r.URL.Query().Get("replies"); replies != "" {
+		n, err := strconv.Atoi(replies)
+		if err != nil {
+			return q, err
+		}
+		q.Replies = n
+	}
+
+	return q, nil
+}
+
 func ParseTime(s string) string {
 
 	t, err := time.Parse(time.DateTime, s)
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+type PersonalAccessToken struct {
+	Id         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"-"` // sha256 hex, the plain token is only shown once
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type PersonalAccessTokenStore struct {
+	db *sql.DB
+}
+
+func (s *PersonalAccessTokenStore) Create(ctx context.Context, token *PersonalAccessToken) error {
+	query := `
+INSERT INTO personal_access_tokens (user_id, name, token, scopes, expiry)
+VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, token.UserID, token.Name, token.Token, pq.Array(token.Scopes), token.Expiry).Scan(&token.Id, &token.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *PersonalAccessTokenStore) GetByUserID(ctx context.Context, userId int64) ([]PersonalAccessToken, error) {
+	query := `
+SELECT id, user_id, name, scopes, expiry, last_used_at, created_at
+FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var t PersonalAccessToken
+		err := rows.Scan(&t.Id, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.Expiry, &t.LastUsedAt, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// GetByToken returns the unexpired token with the given hash.
+func (s *PersonalAccessTokenStore) GetByToken(ctx context.Context, hashToken string) (*PersonalAccessToken, error) {
+	query := `
+SELECT id, user_id, name, scopes, expiry, last_used_at, created_at
+FROM personal_access_tokens WHERE token = $1 AND (expiry IS NULL OR expiry > NOW())
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var t PersonalAccessToken
+	err := s.db.QueryRowContext(ctx, query, hashToken).Scan(&t.Id, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.Expiry, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// Touch records that the token was used. It writes at most once a minute per token.
+func (s *PersonalAccessTokenStore) Touch(ctx context.Context, id int64) error {
+	query := `
+UPDATE personal_access_tokens SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RevokeAllForUser deletes every token of the user, when the account may have been taken over a
+// token the attacker created must not outlive the logout.
+func (s *PersonalAccessTokenStore) RevokeAllForUser(ctx context.Context, userId int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId)
+	return err
+}
+
+func (s *PersonalAccessTokenStore) Delete(ctx context.Context, userId, id int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
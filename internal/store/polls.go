@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 6
+	MaxPollOptionLength = 100
+)
+
+var (
+	ErrPollClosed  = errors.New("poll closed")
+	ErrInvalidVote = errors.New("invalid vote")
+)
+
+// Poll is attached to a post when it is created. Votes and Voters are only set once the viewer
+// voted or the poll closed, so results cannot sway anyone who has not voted yet.
+type Poll struct {
+	Multiple bool         `json:"multiple"` // several options can be picked
+	ClosesAt time.Time    `json:"closes_at"`
+	Closed   bool         `json:"closed"`
+	Voted    bool         `json:"voted"` // the viewer voted
+	Voters   *int64       `json:"voters,omitempty"`
+	Options  []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	ID       int64  `json:"id"`
+	Text     string `json:"text"`
+	Votes    *int64 `json:"votes,omitempty"`
+	Selected bool   `json:"selected"` // picked by the viewer
+}
+
+type PollStore struct {
+	db *sql.DB
+}
+
+// createPoll stores the poll of a post being created, setting the ids of its options.
+func createPoll(ctx context.Context, tx *sql.Tx, postID int64, poll *Poll) error {
+	query := `INSERT INTO polls (post_id, multiple, closes_at) VALUES ($1, $2, $3)`
+
+	if _, err := tx.ExecContext(ctx, query, postID, poll.Multiple, poll.ClosesAt); err != nil {
+		return err
+	}
+
+	for i := range poll.Options {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO poll_options (post_id, position, text) VALUES ($1, $2, $3) RETURNING id`,
+			postID, i, poll.Options[i].Text,
+		).Scan(&poll.Options[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetByPostIDs loads the polls of several posts at once as seen by viewerID, keyed by post id.
+// Posts without a poll are missing from the map.
+func (s *PollStore) GetByPostIDs(ctx context.Context, postIDs []int64, viewerID int64) (map[int64]*Poll, error) {
+	query := `
+SELECT pl.post_id, pl.multiple, pl.closes_at, pl.closes_at <= NOW(),
+    EXISTS (SELECT 1 FROM poll_voters v WHERE v.post_id = pl.post_id AND v.user_id = $2),
+    (SELECT COUNT(*) FROM poll_voters v WHERE v.post_id = pl.post_id),
+    o.id, o.text,
+    (SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id),
+    EXISTS (SELECT 1 FROM poll_votes v WHERE v.option_id = o.id AND v.user_id = $2)
+FROM polls pl
+JOIN poll_options o ON o.post_id = pl.post_id
+WHERE pl.post_id = ANY($1)
+ORDER BY pl.post_id, o.position`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := map[int64]*Poll{}
+	for rows.Next() {
+		var postID, voters int64
+		var p Poll
+		var o PollOption
+		var votes int64
+		err := rows.Scan(&postID, &p.Multiple, &p.ClosesAt, &p.Closed, &p.Voted, &voters, &o.ID, &o.Text, &votes, &o.Selected)
+		if err != nil {
+			return nil, err
+		}
+
+		poll, ok := polls[postID]
+		if !ok {
+			poll = &p
+			if p.Voted || p.Closed {
+				poll.Voters = &voters
+			}
+			polls[postID] = poll
+		}
+		if poll.Voters != nil {
+			o.Votes = &votes
+		}
+		poll.Options = append(poll.Options, o)
+	}
+	return polls, rows.Err()
+}
+
+// Vote records the options the user picked in the poll of the post. Users vote once: a second vote
+// returns ErrConflict. Picking several options in a single choice poll, or options of another poll,
+// returns ErrInvalidVote. optionIDs must not repeat.
+func (s *PollStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var multiple, closed bool
+		err := tx.QueryRowContext(ctx, `SELECT multiple, closes_at <= NOW() FROM polls WHERE post_id = $1`, postID).Scan(&multiple, &closed)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if closed {
+			return ErrPollClosed
+		}
+		if len(optionIDs) == 0 || (!multiple && len(optionIDs) > 1) {
+			return ErrInvalidVote
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO poll_voters (post_id, user_id) VALUES ($1, $2)`, postID, userID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		query := `
+INSERT INTO poll_votes (option_id, user_id)
+SELECT id, $2 FROM poll_options WHERE post_id = $1 AND id = ANY($3)`
+
+		res, err := tx.ExecContext(ctx, query, postID, userID, pq.Array(optionIDs))
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != int64(len(optionIDs)) {
+			return ErrInvalidVote
+		}
+		return nil
+	})
+}
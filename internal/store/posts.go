@@ -3,26 +3,88 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/lib/pq"
+	"time"
 )
 
+var ErrTooManyPinned = errors.New("too many pinned posts")
+
 type Post struct {
-	Id        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comment   []Comment `json:"comment"`
-	User      User      `json:"user"`
+	Id           int64        `json:"id"`
+	Content      string       `json:"content"`
+	Title        string       `json:"title"`
+	UserID       int64        `json:"user_id"`
+	Tags         []string     `json:"tags"`
+	Entities     Entities     `json:"entities"` // mentions and hashtags in Content
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    string       `json:"updated_at"`
+	Version      int          `json:"version"`
+	QuotedPostID *int64       `json:"quoted_post_id"`
+	IsQuote      bool         `json:"is_quote"`   // true with a nil QuotedPostID when the quoted post was deleted
+	Status       string       `json:"status"`     // one of the PostStatus constants
+	Visibility   string       `json:"visibility"` // one of the PostVisibility constants
+	PublishAt    *time.Time   `json:"publish_at"`
+	PublishedAt  *time.Time   `json:"published_at"`
+	DeletedAt    *time.Time   `json:"deleted_at,omitempty"` // only set for posts in the trash
+	DeletedBy    *int64       `json:"deleted_by,omitempty"`
+	DeleteReason string       `json:"delete_reason,omitempty"`
+	PinnedAt     *time.Time   `json:"pinned_at,omitempty"` // pinned to the profile of the author
+	Attachments  []Attachment `json:"attachments"`
+	Poll         *Poll        `json:"poll,omitempty"`
+	Comment      []Comment    `json:"comment"`
+	User         User         `json:"user"`
+}
+
+// Only published posts are visible to other users, drafts and scheduled posts only to their author.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled" // published by the scheduler once publish_at has passed
+	PostStatusPublished = "published"
+)
+
+// Who can see a published post besides its author.
+const (
+	PostVisibilityPublic    = "public"
+	PostVisibilityFollowers = "followers" // the users following the author
+	PostVisibilityPrivate   = "private"   // nobody else
+)
+
+// visibleTo is the SQL condition for the posts under alias that viewer, a parameter or a column,
+// is allowed to see. Checking the status is left to the query.
+func visibleTo(alias, viewer string) string {
+	return `(` + alias + `.visibility = 'public' OR ` + alias + `.user_id = ` + viewer + ` OR (` + alias + `.visibility = 'followers' AND EXISTS (
+        SELECT 1 FROM followers f WHERE f.user_id = ` + alias + `.user_id AND f.follower_id = ` + viewer + `
+    )))`
+}
+
+// QuotedPost is the post a quote refers to, or a tombstone when it was deleted or the viewer cannot see it.
+type QuotedPost struct {
+	Id        int64  `json:"id,omitempty"`
+	UserID    int64  `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Content   string `json:"content,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	Deleted   bool   `json:"deleted"`
+}
+
+// Repost tells who brought a post into the feed when it was not written by someone the user follows.
+type Repost struct {
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	RepostedAt string `json:"reposted_at"`
 }
 
 type PostWithMetaData struct {
-	Post               // it is post embedding
-	CommentCount int64 `json:"comment_count"`
+	Post                             // it is post embedding
+	CommentCount    int64            `json:"comment_count"`
+	Reactions       map[string]int64 `json:"reactions"`        // number of reactions per kind
+	ViewerReactions []string         `json:"viewer_reactions"` // kinds the requesting user reacted with
+	QuotedPost      *QuotedPost      `json:"quoted_post,omitempty"`
+	RepostedBy      *Repost          `json:"reposted_by,omitempty"`
+	AnnouncedUntil  *time.Time       `json:"announced_until,omitempty"` // set on announcements, which come first
 }
 type AllUserPosts struct {
 	Post
@@ -32,8 +94,44 @@ type PostStore struct {
 	db *sql.DB
 }
 
+// GetUserFeed returns the published posts of the user and of everyone they follow, and the posts they reposted,
+// leaving out the posts the user is not allowed to see.
+// A post shows up once, attributed to its most recent repost if it is newer than the post itself.
+// Active announcements are part of every feed and come before everything else.
+// Comment and reaction counts and the user's own reactions are loaded in the same query, only for
+// the posts of the page.
 func (s *PostStore) GetUserFeed(ctx context.Context, userid int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
 	query := `
+WITH authors AS (
+    SELECT $1::bigint AS id
+    UNION SELECT user_id FROM followers WHERE follower_id = $1
+), entries AS (
+    SELECT p.id AS post_id, p.published_at AS activity_at, NULL::bigint AS reposted_by, NULL::timestamptz AS announced_until
+    FROM posts p WHERE p.user_id IN (SELECT id FROM authors) AND p.status = 'published' AND p.deleted_at IS NULL
+    UNION ALL
+    SELECT r.post_id, r.created_at, r.user_id, NULL
+    FROM reposts r WHERE r.user_id IN (SELECT id FROM authors)
+    UNION ALL
+    SELECT a.post_id, a.created_at, NULL, a.expires_at
+    FROM announcements a WHERE a.expires_at > NOW()
+), deduped AS (
+    SELECT DISTINCT ON (post_id) post_id, activity_at, reposted_by, announced_until
+    FROM entries
+    ORDER BY post_id, announced_until NULLS LAST, activity_at DESC, reposted_by NULLS FIRST
+), page AS (
+    SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.visibility, p.tags, p.entities, p.quoted_post_id, p.is_quote,
+        d.activity_at, d.reposted_by, d.announced_until
+    FROM deduped d
+    JOIN posts p ON p.id = d.post_id
+    WHERE
+        p.status = 'published' AND
+        p.deleted_at IS NULL AND
+        ` + visibleTo("p", "$1") + ` AND
+        (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%' ) AND
+        (p.tags @> $5 OR $5 = '{}'  )
+    ORDER BY d.announced_until IS NULL, d.activity_at ` + fq.Sort + `
+    LIMIT $2 OFFSET $3
+)
 SELECT
     p.id,
     p.user_id,
@@ -41,26 +139,48 @@ SELECT
     p.content,
     p.created_at,
     p.version,
+    p.visibility,
     p.tags,
+    p.entities,
     u.username,
-    COUNT(c.id) AS comments_count
+    (
+        SELECT COUNT(*) FROM comments c
+        WHERE c.post_id = p.id AND NOT EXISTS (
+            SELECT 1 FROM comments a WHERE a.id = ANY (c.path) AND a.deleted_at IS NOT NULL
+        )
+    ) AS comments_count,
+    COALESCE(rc.counts, '{}') AS reactions,
+    COALESCE(vr.kinds, '{}') AS viewer_reactions,
+    p.quoted_post_id,
+    p.is_quote,
+    q.user_id,
+    qu.username,
+    q.title,
+    q.content,
+    q.created_at,
+    p.reposted_by,
+    ru.username,
+    p.activity_at,
+    p.announced_until
 FROM 
-    posts p
-LEFT JOIN 
-    comments c ON c.post_id = p.id
+    page p
 LEFT JOIN 
     users u ON p.user_id = u.id
-JOIN 
-    followers f ON f.follower_id = p.user_id OR p.user_id = $1
-WHERE 
-    f.user_id = $1  AND
-    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%' ) AND 
-    (p.tags @> $5 OR $5 = '{}'  )
-GROUP BY 
-    p.id, u.username
+LEFT JOIN 
+    posts q ON q.id = p.quoted_post_id AND q.deleted_at IS NULL AND ` + visibleTo("q", "$1") + `
+LEFT JOIN 
+    users qu ON qu.id = q.user_id
+LEFT JOIN 
+    users ru ON ru.id = p.reposted_by
+LEFT JOIN LATERAL (
+    SELECT jsonb_object_agg(k.kind, k.n) AS counts
+    FROM (SELECT kind, COUNT(*) AS n FROM post_reactions WHERE post_id = p.id GROUP BY kind) k
+) rc ON true
+LEFT JOIN LATERAL (
+    SELECT array_agg(kind ORDER BY kind) AS kinds FROM post_reactions WHERE post_id = p.id AND user_id = $1
+) vr ON true
 ORDER BY 
-    p.created_at ` + fq.Sort + `
-LIMIT $2 OFFSET $3;
+    p.announced_until IS NULL, p.activity_at ` + fq.Sort + `;
 `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
@@ -73,40 +193,110 @@ LIMIT $2 OFFSET $3;
 	var feed []PostWithMetaData
 	for rows.Next() {
 		var p PostWithMetaData
-		err := rows.Scan(&p.Id, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.Version, pq.Array(&p.Tags), &p.User.Username, &p.CommentCount)
+		var reactions []byte
+		var quotedUserID, repostedBy sql.NullInt64
+		var quotedUsername, quotedTitle, quotedContent, quotedCreatedAt, repostedByUsername sql.NullString
+		var activityAt string
+		err := rows.Scan(
+			&p.Id, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.Version, &p.Visibility, pq.Array(&p.Tags), &p.Entities, &p.User.Username, &p.CommentCount,
+			&reactions, pq.Array(&p.ViewerReactions),
+			&p.QuotedPostID, &p.IsQuote, &quotedUserID, &quotedUsername, &quotedTitle, &quotedContent, &quotedCreatedAt,
+			&repostedBy, &repostedByUsername, &activityAt, &p.AnnouncedUntil,
+		)
 		if err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(reactions, &p.Reactions); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case quotedUserID.Valid:
+			p.QuotedPost = &QuotedPost{
+				Id:        *p.QuotedPostID,
+				UserID:    quotedUserID.Int64,
+				Username:  quotedUsername.String,
+				Title:     quotedTitle.String,
+				Content:   quotedContent.String,
+				CreatedAt: quotedCreatedAt.String,
+			}
+		case p.IsQuote:
+			// removed for good, sitting in the trash or hidden from the user
+			p.QuotedPost = &QuotedPost{Deleted: true}
+		}
+
+		if repostedBy.Valid {
+			p.RepostedBy = &Repost{
+				UserID:     repostedBy.Int64,
+				Username:   repostedByUsername.String,
+				RepostedAt: activityAt,
+			}
+		}
+
 		feed = append(feed, p)
 	}
 	return feed, nil
 }
 
+// Create stores the post with the mentions and hashtags found in its content. Hashtags are added
+// to the tags of the post and mentioned users are recorded, in the same transaction as its poll.
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 
 	query := `
- INSERT INTO posts (content, title, user_id, tags) 
- VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+ INSERT INTO posts (content, title, user_id, tags, quoted_post_id, is_quote, status, publish_at, published_at, entities, visibility) 
+ VALUES ($1, $2, $3, $4, $5, $5 IS NOT NULL, $6, $7, CASE WHEN $6 = 'published' THEN NOW() END, $8, $9)
+ RETURNING id, created_at, updated_at, is_quote, published_at
  `
 
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
+	if post.Visibility == "" {
+		post.Visibility = PostVisibilityPublic
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).Scan(&post.Id, &post.CreatedAt, &post.UpdatedAt)
-	if err != nil {
-		return err
-	}
-	return nil
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		found, mentioned, err := parseEntities(ctx, tx, post.Content)
+		if err != nil {
+			return err
+		}
+		post.Entities = found
+		post.Tags = mergeHashtags(post.Tags, found)
+
+		err = tx.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags), post.QuotedPostID, post.Status, post.PublishAt, post.Entities, post.Visibility).Scan(
+			&post.Id, &post.CreatedAt, &post.UpdatedAt, &post.IsQuote, &post.PublishedAt,
+		)
+		if err != nil {
+			// the quoted post does not exist
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" && pqErr.Constraint == "posts_quoted_post_id_fkey" {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if post.Poll != nil {
+			if err := createPoll(ctx, tx, post.Id, post.Poll); err != nil {
+				return err
+			}
+		}
+
+		return setPostMentions(ctx, tx, post.Id, mentioned)
+	})
 }
 
 func (s *PostStore) GetById(ctx context.Context, postId int64) (*Post, error) {
-	query := `SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, p.version
+	query := `SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, p.version, p.quoted_post_id, p.is_quote,
+                    p.status, p.publish_at, p.published_at, p.entities, p.visibility
              FROM posts p
-             WHERE p.id = $1`
+             WHERE p.id = $1 AND p.deleted_at IS NULL`
 	var post Post
 
 	err := s.db.QueryRowContext(ctx, query, postId).Scan(
 		&post.Id, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version,
+		&post.QuotedPostID, &post.IsQuote, &post.Status, &post.PublishAt, &post.PublishedAt, &post.Entities, &post.Visibility,
 	)
 	if err != nil {
 		switch {
@@ -119,13 +309,18 @@ func (s *PostStore) GetById(ctx context.Context, postId int64) (*Post, error) {
 	return &post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, postID int64) error {
+// Delete moves the post to the trash and unpins it, if it is still at version. deletedBy and reason are
+// kept so the author can tell their own deletions, which they may restore, from removals by an admin.
+// It returns ErrEditConflict when the post was changed or deleted since it was read at version.
+func (s *PostStore) Delete(ctx context.Context, postID int64, version int, deletedBy int64, reason string) error {
 
-	query := `DELETE FROM posts WHERE id = $1`
+	query := `
+UPDATE posts SET deleted_at = NOW(), deleted_by = $2, delete_reason = NULLIF($3, ''), pinned_at = NULL
+WHERE id = $1 AND version = $4 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	res, err := s.db.ExecContext(ctx, query, postID)
+	res, err := s.db.ExecContext(ctx, query, postID, deletedBy, reason, version)
 	if err != nil {
 		return err
 	}
@@ -134,37 +329,173 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 		return err
 	}
 	if rows == 0 {
-		return ErrNotFound
+		return ErrEditConflict
 	}
 	return nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
-
-	query := `UPDATE posts SET title = $1, content = $2, version = version + 1  WHERE id = $3 AND version = $4 RETURNING version`
+// GetTrash returns the deleted posts of the user that have not been purged yet, most recently deleted first.
+func (s *PostStore) GetTrash(ctx context.Context, userId int64, q PaginatedQuery) ([]Post, error) {
+	query := `
+SELECT p.id, p.title, p.content, p.user_id, p.tags, p.created_at, p.updated_at, p.version, p.status, p.visibility,
+    p.deleted_at, p.deleted_by, COALESCE(p.delete_reason, '')
+FROM posts p
+WHERE p.user_id = $1 AND p.deleted_at IS NOT NULL
+ORDER BY p.deleted_at ` + q.Sort + `, p.id ` + q.Sort + `
+LIMIT $2 OFFSET $3`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.Id, post.Version).Scan(&post.Version)
+	rows, err := s.db.QueryContext(ctx, query, userId, q.Limit, q.Offset)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
-			return err
+		return nil, err
+	}
+	defer rows.Close()
 
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.Id, &p.Title, &p.Content, &p.UserID, pq.Array(&p.Tags), &p.CreatedAt, &p.UpdatedAt, &p.Version, &p.Status, &p.Visibility,
+			&p.DeletedAt, &p.DeletedBy, &p.DeleteReason,
+		)
+		if err != nil {
+			return nil, err
 		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// Restore takes a post the user deleted themselves out of the trash, as long as it was deleted after since.
+// Posts removed by someone else stay deleted and ErrNotFound is returned.
+func (s *PostStore) Restore(ctx context.Context, userId, postID int64, since time.Time) error {
+	query := `
+UPDATE posts SET deleted_at = NULL, deleted_by = NULL, delete_reason = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_by = $2 AND deleted_at > $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postID, userId, since)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
 
-func (s *PostStore) GetAllUserPosts(ctx context.Context, userid int64) ([]AllUserPosts, error) {
-	query := `SELECT p.id,p.title,p.content,p.created_at,p.version,p.tags FROM posts p JOIN users ON p.user_id = users.id WHERE user_id = $1 ORDER BY p.created_at DESC`
+// PurgeDeleted removes posts that were deleted before the given time for good, with everything attached
+// to them. It returns the number of posts and the blob keys of their attachments, which are deleted in
+// the same statement, so a post restored meanwhile keeps its files.
+func (s *PostStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, []string, error) {
+	query := `
+WITH purged AS (
+    DELETE FROM posts WHERE deleted_at < $1 RETURNING id
+), removed AS (
+    DELETE FROM attachments a USING purged WHERE a.post_id = purged.id RETURNING a.storage_key
+)
+SELECT (SELECT COUNT(*) FROM purged), ARRAY(SELECT storage_key FROM removed)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var posts int64
+	var keys []string
+	if err := s.db.QueryRowContext(ctx, query, before).Scan(&posts, pq.Array(&keys)); err != nil {
+		return 0, nil, err
+	}
+	return posts, keys, nil
+}
+
+// Update saves the post if it is still at post.Version, and keeps the replaced title and content
+// as a revision edited by editorId. Entities and mentions follow the new content like in Create,
+// but only hashtags that are new to the content are added to the tags, so removing a tag sticks.
+// It returns ErrEditConflict when the post was changed or deleted since it was read at post.Version.
+func (s *PostStore) Update(ctx context.Context, post *Post, editorId int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// the row lock keeps a concurrent edit from writing the same revision
+		revision := `
+INSERT INTO post_revisions (post_id, version, title, content, edited_by)
+SELECT id, version, title, content, $3
+FROM posts
+WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+FOR UPDATE
+RETURNING content`
+
+		var previous string
+		err := tx.QueryRowContext(ctx, revision, post.Id, post.Version, editorId).Scan(&previous)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		found, mentioned, err := parseEntities(ctx, tx, post.Content)
+		if err != nil {
+			return err
+		}
+		post.Entities = found
+		post.Tags = mergeHashtags(post.Tags, addedHashtags(found, previous))
+
+		query := `
+UPDATE posts SET
+    title = $1,
+    content = $2,
+    status = $5,
+    publish_at = $6,
+    tags = $7,
+    entities = $8,
+    visibility = $9,
+    published_at = CASE WHEN $5 = 'published' THEN COALESCE(published_at, NOW()) END,
+    updated_at = NOW(),
+    version = version + 1
+WHERE id = $3 AND version = $4
+RETURNING version, published_at, updated_at
+`
+
+		err = tx.QueryRowContext(ctx, query, post.Title, post.Content, post.Id, post.Version, post.Status, post.PublishAt, pq.Array(post.Tags), post.Entities, post.Visibility).Scan(
+			&post.Version, &post.PublishedAt, &post.UpdatedAt,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		return setPostMentions(ctx, tx, post.Id, mentioned)
+	})
+}
+
+// GetAllUserPosts returns the posts of userid as seen by viewerID: drafts and scheduled posts are
+// only included when the viewer is the author, and so are the posts they may not see. Pinned posts
+// come first, most recently pinned first.
+func (s *PostStore) GetAllUserPosts(ctx context.Context, userid int64, viewerID int64) ([]AllUserPosts, error) {
+	query := `
+SELECT p.id,p.title,p.content,p.created_at,p.version,p.tags,p.status,p.publish_at,p.published_at,p.entities,p.visibility,p.pinned_at
+FROM posts p JOIN users ON p.user_id = users.id
+WHERE user_id = $1 AND p.deleted_at IS NULL AND (p.status = 'published' OR p.user_id = $2) AND ` + visibleTo("p", "$2") + `
+ORDER BY p.pinned_at DESC NULLS LAST, p.created_at DESC`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, query, userid)
+	rows, err := s.db.QueryContext(ctx, query, userid, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -172,7 +503,7 @@ func (s *PostStore) GetAllUserPosts(ctx context.Context, userid int64) ([]AllUse
 	var userPosts []AllUserPosts
 	for rows.Next() {
 		var up AllUserPosts
-		err := rows.Scan(&up.Id, &up.Title, &up.Content, &up.CreatedAt, &up.Version, pq.Array(&up.Tags))
+		err := rows.Scan(&up.Id, &up.Title, &up.Content, &up.CreatedAt, &up.Version, pq.Array(&up.Tags), &up.Status, &up.PublishAt, &up.PublishedAt, &up.Entities, &up.Visibility, &up.PinnedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -182,3 +513,135 @@ func (s *PostStore) GetAllUserPosts(ctx context.Context, userid int64) ([]AllUse
 	return userPosts, nil
 
 }
+
+// Pin pins a published post of the user to their profile. Pinning a pinned post is a no-op, and
+// ErrTooManyPinned is returned when the user already pinned max posts.
+func (s *PostStore) Pin(ctx context.Context, userId, postId int64, max int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// the user row lock keeps concurrent pins from going over max
+		var pinned int
+		err := tx.QueryRowContext(ctx, `
+SELECT (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.pinned_at IS NOT NULL)
+FROM users u WHERE u.id = $1
+FOR UPDATE`, userId).Scan(&pinned)
+		if err != nil {
+			return err
+		}
+
+		var already bool
+		err = tx.QueryRowContext(ctx, `
+SELECT pinned_at IS NOT NULL FROM posts
+WHERE id = $1 AND user_id = $2 AND status = 'published' AND deleted_at IS NULL`, postId, userId).Scan(&already)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if already {
+			return nil
+		}
+		if pinned >= max {
+			return ErrTooManyPinned
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET pinned_at = NOW() WHERE id = $1`, postId)
+		return err
+	})
+}
+
+func (s *PostStore) Unpin(ctx context.Context, userId, postId int64) error {
+	query := `UPDATE posts SET pinned_at = NULL WHERE id = $1 AND user_id = $2 AND pinned_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postId, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PublishDue publishes scheduled posts whose publish_at has passed and returns how many it published.
+// Rows another replica is already publishing are skipped, so any number of schedulers can run at once.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) (int64, error) {
+	query := `
+WITH due AS (
+    SELECT id FROM posts
+    WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+    ORDER BY publish_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+UPDATE posts p SET status = 'published', published_at = NOW()
+FROM due
+WHERE p.id = due.id
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetMentioning returns the published posts that mention the user, in the post or in one of its
+// comments that is not in the trash, and that they may see, newest first unless sorted asc.
+func (s *PostStore) GetMentioning(ctx context.Context, userId int64, q PaginatedQuery) ([]Post, error) {
+	query := `
+SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, p.entities,
+    p.status, p.visibility, p.published_at, u.id, u.username
+FROM posts p
+JOIN users u ON u.id = p.user_id
+WHERE p.id IN (
+    SELECT post_id FROM post_mentions WHERE user_id = $1
+    UNION
+    SELECT c.post_id
+    FROM comment_mentions m
+    JOIN comments c ON c.id = m.comment_id
+    WHERE m.user_id = $1 AND NOT EXISTS (
+        SELECT 1 FROM comments a WHERE a.id = ANY (c.path) AND a.deleted_at IS NOT NULL
+    )
+) AND p.status = 'published' AND p.deleted_at IS NULL AND ` + visibleTo("p", "$1") + `
+ORDER BY p.published_at ` + q.Sort + `, p.id ` + q.Sort + `
+LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.Id, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.Version, pq.Array(&p.Tags), &p.Entities,
+			&p.Status, &p.Visibility, &p.PublishedAt, &p.User.Id, &p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add records the user's reaction of the given kind to the post. Reacting twice with the same kind is a no-op.
+func (s *ReactionStore) Add(ctx context.Context, postID, userID int64, kind string) error {
+	query := `INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *ReactionStore) Remove(ctx context.Context, postID, userID int64, kind string) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	if err != nil {
+		return err
+	}
+	return nil
+}
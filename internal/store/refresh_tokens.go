@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+type RefreshToken struct {
+	Id        int64
+	Token     string // sha256 hex of the token handed to the client
+	UserID    int64
+	FamilyID  string // every rotation of one login shares the family
+	Expiry    time.Time
+	CreatedAt time.Time
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (token, user_id, family_id, expiry) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, token.Token, token.UserID, token.FamilyID, token.Expiry).Scan(&token.Id, &token.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Consume marks a refresh token as used and returns it, so it can be rotated into a new one.
+// Presenting a token that was already used or revoked is treated as theft: the whole family is
+// revoked and ErrRefreshTokenReused is returned.
+func (s *RefreshTokenStore) Consume(ctx context.Context, hashToken string) (*RefreshToken, error) {
+	query := `
+UPDATE refresh_tokens SET used_at = NOW()
+WHERE token = $1 AND used_at IS NULL AND revoked_at IS NULL AND expiry > NOW()
+RETURNING id, token, user_id, family_id, expiry, created_at
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var token RefreshToken
+	err := s.db.QueryRowContext(ctx, query, hashToken).Scan(
+		&token.Id, &token.Token, &token.UserID, &token.FamilyID, &token.Expiry, &token.CreatedAt,
+	)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// the token is unknown, expired, or has been presented before
+	var familyID string
+	reused := `SELECT family_id FROM refresh_tokens WHERE token = $1 AND (used_at IS NOT NULL OR revoked_at IS NOT NULL)`
+	err = s.db.QueryRowContext(ctx, reused, hashToken).Scan(&familyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if err := s.RevokeFamily(ctx, familyID); err != nil {
+		return nil, err
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// RevokeFamily revokes every refresh token of the family and ends the session it belongs to,
+// so access tokens already handed out for it stop working too.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, familyID); err != nil {
+			return err
+		}
+
+		session := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+		if _, err := tx.ExecContext(ctx, session, familyID); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// RevokeFamilyOf revokes the family the given token belongs to, as long as it belongs to the user.
+func (s *RefreshTokenStore) RevokeFamilyOf(ctx context.Context, hashToken string, userId int64) error {
+	query := `
+UPDATE refresh_tokens SET revoked_at = NOW()
+WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = $1 AND user_id = $2) AND revoked_at IS NULL
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *RefreshTokenStore) RevokeAllForUser(ctx context.Context, userId int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// PostRevision is a version of a post that was replaced by an edit. EditedBy is the user who made
+// that edit, so moderator changes to someone else's post can be told apart from the author's own.
+type PostRevision struct {
+	PostID   int64  `json:"post_id"`
+	Version  int    `json:"version"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	EditedBy *int64 `json:"edited_by"` // nil once the editor's account is deleted
+	EditedAt string `json:"edited_at"`
+}
+
+type RevisionStore struct {
+	db *sql.DB
+}
+
+// GetByPostID returns the previous versions of a post, newest first unless sorted asc.
+func (s *RevisionStore) GetByPostID(ctx context.Context, postId int64, q PaginatedQuery) ([]PostRevision, error) {
+	query := `
+SELECT post_id, version, title, content, edited_by, edited_at
+FROM post_revisions
+WHERE post_id = $1
+ORDER BY version ` + q.Sort + `
+LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postId, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		if err := rows.Scan(&rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.EditedBy, &rev.EditedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *RevisionStore) Get(ctx context.Context, postId int64, version int) (*PostRevision, error) {
+	query := `
+SELECT post_id, version, title, content, edited_by, edited_at
+FROM post_revisions
+WHERE post_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postId, version).Scan(
+		&rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.EditedBy, &rev.EditedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rev, nil
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// revocationCacheTTL is how long a "not revoked" answer is trusted before asking postgres again.
+// Revocations made by this process are visible immediately, the ones made by other replicas
+// after at most this long.
+const revocationCacheTTL = 30 * time.Second
+
+type userGeneration struct {
+	generation int64
+	checkedAt  time.Time
+}
+
+// RevocationStore is the jti denylist. It is backed by postgres and keeps an in-process cache
+// so that the check done on every authenticated request rarely needs a query.
+type RevocationStore struct {
+	db *sql.DB
+
+	mu          sync.Mutex
+	revoked     map[string]time.Time // jti -> token expiry, revoked for good
+	notRevoked  map[string]time.Time // jti -> when it was last seen not revoked
+	generations map[int64]userGeneration
+	lastPrune   time.Time
+}
+
+func newRevocationStore(db *sql.DB) *RevocationStore {
+	return &RevocationStore{
+		db:          db,
+		revoked:     make(map[string]time.Time),
+		notRevoked:  make(map[string]time.Time),
+		generations: make(map[int64]userGeneration),
+		lastPrune:   time.Now(),
+	}
+}
+
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, userId int64, expiry time.Time) error {
+	query := `INSERT INTO revoked_tokens (jti, user_id, expiry) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, jti, userId, expiry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiry
+	delete(s.notRevoked, jti)
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeAllForUser rejects every token of the user issued up to now by moving the user to the next
+// token generation. Unlike a time cutoff it cannot catch a token issued in the same second afterwards.
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, userId int64) error {
+	query := `
+INSERT INTO user_token_revocations (user_id, generation) VALUES ($1, 1)
+ON CONFLICT (user_id) DO UPDATE SET generation = user_token_revocations.generation + 1
+RETURNING generation
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var generation int64
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&generation)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.generations[userId] = userGeneration{generation: generation, checkedAt: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+// Generation returns the current token generation of the user, new tokens carry it in their "gen"
+// claim. It always asks postgres, a stale generation would issue tokens that are already revoked.
+func (s *RevocationStore) Generation(ctx context.Context, userId int64) (int64, error) {
+	query := `SELECT generation FROM user_token_revocations WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var generation int64
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&generation)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	// a concurrent RevokeAllForUser may have cached a newer generation already, generations only go up
+	if cached, ok := s.generations[userId]; !ok || generation >= cached.generation {
+		s.generations[userId] = userGeneration{generation: generation, checkedAt: time.Now()}
+	}
+	s.mu.Unlock()
+	return generation, nil
+}
+
+// IsRevoked reports whether the token identified by jti, issued to the user in the given generation,
+// was revoked on its own or by a "log out everywhere" of the user.
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string, userId int64, generation int64) (bool, error) {
+	current, err := s.userGeneration(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	if generation < current {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	s.pruneLocked()
+	if _, ok := s.revoked[jti]; ok {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if checkedAt, ok := s.notRevoked[jti]; ok && time.Since(checkedAt) < revocationCacheTTL {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	query := `SELECT expiry FROM revoked_tokens WHERE jti = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var expiry time.Time
+	err = s.db.QueryRowContext(ctx, query, jti).Scan(&expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			s.mu.Lock()
+			s.notRevoked[jti] = time.Now()
+			s.mu.Unlock()
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiry
+	s.mu.Unlock()
+	return true, nil
+}
+
+// userGeneration returns the token generation of the user, from the cache while it is fresh. A token
+// of a newer generation than the cached one is never rejected, so a stale cache only delays revocations.
+func (s *RevocationStore) userGeneration(ctx context.Context, userId int64) (int64, error) {
+	s.mu.Lock()
+	cached, ok := s.generations[userId]
+	s.mu.Unlock()
+	if ok && time.Since(cached.checkedAt) < revocationCacheTTL {
+		return cached.generation, nil
+	}
+	return s.Generation(ctx, userId)
+}
+
+// pruneLocked drops cache entries that can no longer matter. s.mu must be held.
+func (s *RevocationStore) pruneLocked() {
+	if time.Since(s.lastPrune) < time.Minute {
+		return
+	}
+	now := time.Now()
+	for jti, expiry := range s.revoked {
+		if now.After(expiry) {
+			delete(s.revoked, jti)
+		}
+	}
+	for jti, checkedAt := range s.notRevoked {
+		if now.Sub(checkedAt) >= revocationCacheTTL {
+			delete(s.notRevoked, jti)
+		}
+	}
+	for userId, cached := range s.generations {
+		if now.Sub(cached.checkedAt) >= revocationCacheTTL {
+			delete(s.generations, userId)
+		}
+	}
+	s.lastPrune = now
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSessionRevoked = errors.New("session revoked")
+
+// sessionSeenInterval throttles last_seen_at updates so an active client does not write on every request.
+const sessionSeenInterval = time.Minute
+
+// Session is one login on one device. Its id is also the family id of its refresh tokens
+// and the "sid" claim of its access tokens.
+type Session struct {
+	Id         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Expiry     time.Time `json:"expiry"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"` // set by the handler for the session making the request
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session) error {
+	query := `
+INSERT INTO sessions (id, user_id, user_agent, ip, expiry) VALUES ($1, $2, $3, $4, $5)
+RETURNING last_seen_at, created_at
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, session.Id, session.UserID, session.UserAgent, session.IP, session.Expiry).Scan(
+		&session.LastSeenAt, &session.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetByUserID returns the sessions of the user that are neither revoked nor expired, most recently used first.
+func (s *SessionStore) GetByUserID(ctx context.Context, userId int64) ([]Session, error) {
+	query := `
+SELECT id, user_id, user_agent, ip, expiry, last_seen_at, created_at FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND expiry > NOW()
+ORDER BY last_seen_at DESC
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.Id, &session.UserID, &session.UserAgent, &session.IP, &session.Expiry, &session.LastSeenAt, &session.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Seen reports whether the session is still active and records the activity.
+func (s *SessionStore) Seen(ctx context.Context, id string, userId int64) (bool, error) {
+	query := `SELECT revoked_at IS NULL AND expiry > NOW(), last_seen_at FROM sessions WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var active bool
+	var lastSeenAt time.Time
+	err := s.db.QueryRowContext(ctx, query, id, userId).Scan(&active, &lastSeenAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	if active && time.Since(lastSeenAt) > sessionSeenInterval {
+		update := `UPDATE sessions SET last_seen_at = NOW() WHERE id = $1`
+		if _, err := s.db.ExecContext(ctx, update, id); err != nil {
+			return false, err
+		}
+	}
+	return active, nil
+}
+
+// Extend moves the expiry of the session along with its latest refresh token.
+// It returns ErrNotFound when the session does not exist and ErrSessionRevoked when it was revoked.
+func (s *SessionStore) Extend(ctx context.Context, id string, expiry time.Time) error {
+	query := `UPDATE sessions SET expiry = $1, last_seen_at = NOW() WHERE id = $2 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, expiry, id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrSessionRevoked
+	}
+	return ErrNotFound
+}
+
+// Revoke ends one session of the user together with its refresh tokens.
+func (s *SessionStore) Revoke(ctx context.Context, userId int64, id string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, id, userId)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		refresh := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+		if _, err := tx.ExecContext(ctx, refresh, id); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *SessionStore) RevokeAllForUser(ctx context.Context, userId int64) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
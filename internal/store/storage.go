@@ -10,6 +10,7 @@ import (
 var (
 	ErrNotFound          = errors.New("record not found")
 	ErrConflict          = errors.New("resource already exists")
+	ErrEditConflict      = errors.New("edit conflict")
 	QueryTimeOutDuration = time.Second * 5
 )
 
@@ -19,10 +20,17 @@ type Storage struct {
 	Posts interface {
 		GetById(context.Context, int64) (*Post, error)
 		Create(context.Context, *Post) error
-		Delete(context.Context, int64) error
-		Update(context.Context, *Post) error
+		Delete(ctx context.Context, postID int64, version int, deletedBy int64, reason string) error
+		Update(ctx context.Context, post *Post, editorId int64) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetaData, error)
-		GetAllUserPosts(context.Context, int64) ([]AllUserPosts, error)
+		GetAllUserPosts(ctx context.Context, userid int64, viewerID int64) ([]AllUserPosts, error)
+		PublishDue(ctx context.Context, limit int) (int64, error)
+		GetTrash(ctx context.Context, userId int64, q PaginatedQuery) ([]Post, error)
+		Restore(ctx context.Context, userId, postID int64, since time.Time) error
+		PurgeDeleted(ctx context.Context, before time.Time) (int64, []string, error)
+		GetMentioning(ctx context.Context, userId int64, q PaginatedQuery) ([]Post, error)
+		Pin(ctx context.Context, userId, postId int64, max int) error
+		Unpin(ctx context.Context, userId, postId int64) error
 	}
 	Users interface {
 		GetById(context.Context, int64) (*User, error)
@@ -30,28 +38,146 @@ type Storage struct {
 		Create(context.Context, *sql.Tx, *User) error
 		CreateAndInvite(context.Context, *User, string, time.Duration) error
 		Activate(context.Context, string) error
+		RotateInvitation(ctx context.Context, email string, token string, invitationExp time.Duration) (*User, error)
+		DeleteExpiredInvitations(context.Context) (int64, error)
+		DeleteUnactivated(ctx context.Context, grace time.Duration) (int64, error)
 		Delete(context.Context, int64) error
+		CreatePasswordReset(context.Context, int64, string, time.Duration) error
+		ResetPassword(context.Context, string, *User) error
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetPageByPostID(context.Context, int64, CommentQuery) ([]Comment, error)
+		GetById(context.Context, int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(ctx context.Context, commentID int64, deletedBy int64, reason string) error
+		GetTrash(ctx context.Context, userId int64, q PaginatedQuery) ([]Comment, error)
+		Restore(ctx context.Context, userId, commentID int64, since time.Time) error
+		PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	}
+	Attachments interface {
+		Create(ctx context.Context, a *Attachment, maxPerPost int) error
+		GetById(context.Context, int64) (*Attachment, error)
+		GetByPostIDs(context.Context, []int64) (map[int64][]Attachment, error)
+		Delete(ctx context.Context, postID, id int64) (*Attachment, error)
+	}
+	Announcements interface {
+		Set(context.Context, *Announcement) error
+		Delete(context.Context, int64) error
+		DeleteExpired(context.Context) (int64, error)
+	}
+	Polls interface {
+		GetByPostIDs(ctx context.Context, postIDs []int64, viewerID int64) (map[int64]*Poll, error)
+		Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error
+	}
+	Tags interface {
+		Search(context.Context, TagQuery) ([]TagCount, error)
+		Refresh(context.Context) error
+	}
+	Revisions interface {
+		GetByPostID(context.Context, int64, PaginatedQuery) ([]PostRevision, error)
+		Get(ctx context.Context, postId int64, version int) (*PostRevision, error)
+	}
+	Reactions interface {
+		Add(ctx context.Context, postID, userID int64, kind string) error
+		Remove(ctx context.Context, postID, userID int64, kind string) error
+	}
+	Reposts interface {
+		Add(ctx context.Context, userId, postId int64) error
+		Remove(ctx context.Context, userId, postId int64) error
+	}
+	Bookmarks interface {
+		CreateCollection(context.Context, *Collection) error
+		GetCollections(context.Context, int64) ([]Collection, error)
+		GetCollection(ctx context.Context, userId, id int64) (*Collection, error)
+		RenameCollection(context.Context, *Collection) error
+		DeleteCollection(ctx context.Context, userId, id int64) error
+		AddPost(ctx context.Context, collectionId, postId int64) error
+		RemovePost(ctx context.Context, collectionId, postId int64) error
+		GetPosts(context.Context, int64, PaginatedFeedQuery) ([]SavedPost, error)
 	}
 	Followers interface {
 		Follow(ctx context.Context, followerId, userId int64) error
 		Unfollow(ctx context.Context, followerId, userId int64) error
+		IsFollowing(ctx context.Context, followerId, userId int64) (bool, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	LoginAttempts interface {
+		LockedUntil(ctx context.Context, scope, key string) (time.Time, error)
+		RegisterFailure(ctx context.Context, scope, key string, maxFailures int, window, lockout time.Duration) error
+		Reset(ctx context.Context, scope, key string) error
+	}
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		Consume(context.Context, string) (*RefreshToken, error)
+		RevokeFamily(context.Context, string) error
+		RevokeFamilyOf(context.Context, string, int64) error
+		RevokeAllForUser(context.Context, int64) error
+	}
+	Revocations interface {
+		Revoke(ctx context.Context, jti string, userId int64, expiry time.Time) error
+		RevokeAllForUser(context.Context, int64) error
+		IsRevoked(ctx context.Context, jti string, userId int64, generation int64) (bool, error)
+		Generation(context.Context, int64) (int64, error)
+	}
+	MFA interface {
+		GetTOTP(context.Context, int64) (*TOTP, error)
+		SetPendingSecret(ctx context.Context, userId int64, secret string) error
+		EnableTOTP(ctx context.Context, userId int64, secret string, step int64, recoveryCodes []string) error
+		DisableTOTP(context.Context, int64) error
+		UseTOTPStep(ctx context.Context, userId int64, step int64) (bool, error)
+		UseRecoveryCode(ctx context.Context, userId int64, code string) (bool, error)
+	}
+	PersonalAccessTokens interface {
+		Create(context.Context, *PersonalAccessToken) error
+		GetByUserID(context.Context, int64) ([]PersonalAccessToken, error)
+		GetByToken(context.Context, string) (*PersonalAccessToken, error)
+		Touch(context.Context, int64) error
+		Delete(ctx context.Context, userId, id int64) error
+		RevokeAllForUser(context.Context, int64) error
+	}
+	Identities interface {
+		CreateLoginState(context.Context, *OIDCLoginState) error
+		ConsumeLoginState(context.Context, string) (*OIDCLoginState, error)
+		DeleteExpiredLoginStates(context.Context) (int64, error)
+		GetUserID(ctx context.Context, provider, subject string) (int64, error)
+		Link(context.Context, *UserIdentity) error
+		CreateUserWithIdentity(context.Context, *User, *UserIdentity) error
+	}
+	Sessions interface {
+		Create(context.Context, *Session) error
+		GetByUserID(context.Context, int64) ([]Session, error)
+		Seen(ctx context.Context, id string, userId int64) (bool, error)
+		Extend(ctx context.Context, id string, expiry time.Time) error
+		Revoke(ctx context.Context, userId int64, id string) error
+		RevokeAllForUser(context.Context, int64) error
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &comentStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RoleStore{db},
+		Posts:                &PostStore{db},
+		Users:                &UserStore{db},
+		Comments:             &comentStore{db},
+		Reactions:            &ReactionStore{db},
+		Reposts:              &RepostStore{db},
+		Revisions:            &RevisionStore{db},
+		Tags:                 &TagStore{db},
+		Attachments:          &AttachmentStore{db},
+		Polls:                &PollStore{db},
+		Announcements:        &AnnouncementStore{db},
+		Bookmarks:            &BookmarkStore{db},
+		Followers:            &FollowerStore{db},
+		Roles:                &RoleStore{db},
+		LoginAttempts:        &LoginAttemptStore{db},
+		RefreshTokens:        &RefreshTokenStore{db},
+		Revocations:          newRevocationStore(db),
+		MFA:                  &MFAStore{db},
+		PersonalAccessTokens: &PersonalAccessTokenStore{db},
+		Identities:           &IdentityStore{db},
+		Sessions:             &SessionStore{db},
 	}
 }
 
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	MaxTagsPerPost = 10
+	MaxTagLength   = 30
+)
+
+// NormalizeTag lowercases a tag and drops a leading # and surrounding spaces. Tags are made of
+// letters, digits, _ and -, so "#GoLang " and "golang" are the same tag.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" {
+		return "", fmt.Errorf("tags cannot be empty")
+	}
+	if n := len([]rune(tag)); n > MaxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return "", fmt.Errorf("tag %q may only contain letters, digits, _ and -", tag)
+		}
+	}
+	return tag, nil
+}
+
+// NormalizeTags normalizes and deduplicates the tags of a post, keeping their order, and enforces MaxTagsPerPost.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		t, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		normalized = append(normalized, t)
+	}
+	if len(normalized) > MaxTagsPerPost {
+		return nil, fmt.Errorf("a post can have at most %d tags", MaxTagsPerPost)
+	}
+	return normalized, nil
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Posts int64  `json:"posts"` // published posts using the tag
+}
+
+// TagQuery looks up the most used tags, optionally only those starting with Prefix for autocomplete.
+type TagQuery struct {
+	Prefix string `json:"prefix" validate:"max=30"`
+	Limit  int    `json:"limit" validate:"min=1,max=50"`
+}
+
+func (q TagQuery) Parse(r *http.Request) (TagQuery, error) {
+	qs := r.URL.Query()
+
+	if prefix := qs.Get("q"); prefix != "" {
+		q.Prefix = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(prefix), "#"))
+	}
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+
+	return q, nil
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// Search returns the tags of published public posts, most used first. The counts come from the
+// tag_counts view, so they lag behind new posts until the next Refresh.
+func (s *TagStore) Search(ctx context.Context, q TagQuery) ([]TagCount, error) {
+	query := `SELECT tag, posts FROM tag_counts ORDER BY posts DESC, tag LIMIT $1`
+	args := []any{q.Limit}
+	if q.Prefix != "" {
+		// a literal prefix, so idx_tag_counts_tag can be used
+		query = `SELECT tag, posts FROM tag_counts WHERE tag LIKE $2 ORDER BY posts DESC, tag LIMIT $1`
+		args = append(args, escapeLike(q.Prefix)+"%")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Tag, &t.Posts); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// Refresh recounts the tags. Searches keep reading the previous counts while it runs.
+func (s *TagStore) Refresh(ctx context.Context) error {
+	// no QueryTimeOutDuration, recounting takes longer than a query and runs in the background
+	_, err := s.db.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY tag_counts`)
+	return err
+}
+
+// escapeLike escapes the LIKE wildcards, _ being valid in tags.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
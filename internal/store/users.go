@@ -16,14 +16,15 @@ var (
 )
 
 type User struct {
-	Id        int64    `json:"id"`
-	Username  string   `json:"username"`
-	Email     string   `json:"email"`
-	Password  password `json:"-"`
-	CreatedAt string   `json:"created_at"`
-	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
+	Id          int64    `json:"id"`
+	Username    string   `json:"username"`
+	Email       string   `json:"email"`
+	Password    password `json:"-"`
+	CreatedAt   string   `json:"created_at"`
+	IsActive    bool     `json:"is_active"`
+	RoleID      int64    `json:"role_id"`
+	Role        Role     `json:"role"`
+	TOTPEnabled bool     `json:"totp_enabled"`
 }
 
 type password struct {
@@ -41,6 +42,10 @@ func (p *password) Set(text string) error {
 	return nil
 }
 
+func (p *password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
+}
+
 type UserStore struct {
 	db *sql.DB
 }
@@ -75,7 +80,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 }
 
 func (s *UserStore) GetById(ctx context.Context, userId int64) (*User, error) {
-	query := `SELECT u.id, u.email, u.username, u.password, u.created_at, u.is_active, r.id AS role_id, r.name, r.description, r.level
+	query := `SELECT u.id, u.email, u.username, u.password, u.created_at, u.is_active, u.totp_enabled, r.id AS role_id, r.name, r.description, r.level
 			  FROM users u
 			  JOIN roles r ON u.role_id = r.id
 			  WHERE u.id = $1 AND u.is_active = true`
@@ -83,7 +88,7 @@ func (s *UserStore) GetById(ctx context.Context, userId int64) (*User, error) {
 	var user User
 
 	err := s.db.QueryRowContext(ctx, query, userId).Scan(
-		&user.Id, &user.Email, &user.Username, &user.Password.hash, &user.CreatedAt, &user.IsActive,
+		&user.Id, &user.Email, &user.Username, &user.Password.hash, &user.CreatedAt, &user.IsActive, &user.TOTPEnabled,
 		&user.Role.Id, &user.Role.Name, &user.Role.Description, &user.Role.Level,
 	)
 	if err != nil {
@@ -123,6 +128,77 @@ func (s *UserStore) createUserninvitation(ctx context.Context, tx *sql.Tx, token
 	return nil
 }
 
+// RotateInvitation replaces the invitations of the not yet activated user with the given email
+// by a new one. It returns ErrNotFound when there is no such user.
+func (s *UserStore) RotateInvitation(ctx context.Context, email string, token string, invitationExp time.Duration) (*User, error) {
+	var user User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `SELECT id, username, email, created_at, is_active FROM users WHERE email = $1 AND is_active = false FOR UPDATE`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, email).Scan(&user.Id, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, user.Id); err != nil {
+			return err
+		}
+		return s.createUserninvitation(ctx, tx, token, invitationExp, user.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteExpiredInvitations removes invitations that can no longer be used and returns how many there were.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `DELETE FROM user_invitations WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteUnactivated deletes accounts that were never activated, registered more than grace ago and
+// have no usable invitation left, so their username and email can be registered again.
+func (s *UserStore) DeleteUnactivated(ctx context.Context, grace time.Duration) (int64, error) {
+	query := `
+WITH deleted AS (
+    DELETE FROM users u
+    WHERE u.is_active = false
+      AND u.created_at < NOW() - make_interval(secs => $1)
+      AND NOT EXISTS (SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id AND ui.expiry > NOW())
+    RETURNING u.id
+), invitations AS (
+    DELETE FROM user_invitations WHERE user_id IN (SELECT id FROM deleted)
+)
+SELECT COUNT(*) FROM deleted
+`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var count int64
+	if err := s.db.QueryRowContext(ctx, query, grace.Seconds()).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (s *UserStore) Activate(ctx context.Context, token string) error {
 	// 1 find the user that this token belongs to
 	// 2 update the user state(Active state)
@@ -223,13 +299,13 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userId int64) error
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 
-	query := `SELECT id, username, email, password, created_at FROM users WHERE email = $1 AND is_active = true`
+	query := `SELECT id, username, email, password, created_at, totp_enabled FROM users WHERE email = $1 AND is_active = true`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
 	user := &User{}
-	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.Id, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.Id, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.TOTPEnabled)
 
 	if err != nil {
 		switch err {
@@ -241,3 +317,91 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	}
 	return user, nil
 }
+
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration) error {
+	// only the latest requested link stays valid
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deletePasswordResets(ctx, tx, userId); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+		defer cancel()
+		_, err := tx.ExecContext(ctx, query, token, userId, time.Now().Add(exp))
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// ResetPassword stores user.Password for the owner of the reset token and burns the token.
+// The user is filled in with the owner of the token.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		owner, err := s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		user.Id = owner.Id
+		user.Username = owner.Username
+		user.Email = owner.Email
+		user.CreatedAt = owner.CreatedAt
+		user.IsActive = owner.IsActive
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := s.deletePasswordResets(ctx, tx, user.Id); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active FROM users u JOIN password_resets pr ON u.id = pr.user_id WHERE pr.token = $1 AND pr.expiry > $2 FOR UPDATE OF pr`
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	var user User
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+		&user.Id, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.Id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userId int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}